@@ -0,0 +1,68 @@
+/*
+Audit.go provides an audit trail of health check results, kept separate from the operational logs.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRecord is a single line of the audit trail.
+type auditRecord struct {
+	Time   string `json:"time"`
+	Source string `json:"source"`
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditLogger appends a JSON record per health check to a dedicated audit file.
+type AuditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewAuditLogger opens the audit file at path for appending, creating it if needed.
+func NewAuditLogger(path string) (*AuditLogger, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLogger{file: file}, nil
+}
+
+// Record appends the result of a health check requested by remoteAddr.  Each
+// record is written with a single append, so records are never interleaved with
+// those of other writers to the same file.
+func (a *AuditLogger) Record(remoteAddr string, result CheckResult) error {
+	source, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		source = remoteAddr
+	}
+
+	line, err := json.Marshal(auditRecord{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Source: source,
+		Result: result.Status.String(),
+		Reason: string(result.Reason),
+	})
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.file.Write(append(line, '\n'))
+
+	return err
+}
+
+// Close closes the audit file.
+func (a *AuditLogger) Close() error {
+	return a.file.Close()
+}
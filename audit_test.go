@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLogger, err := NewAuditLogger(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+
+	results := []CheckResult{{Status: Available}, {Status: NotReady, Reason: ReasonWsrepNotReady}}
+	for _, result := range results {
+		if err := auditLogger.Record("192.0.2.10:51234", result); err != nil {
+			t.Errorf("Failed to write audit record: %v", err)
+		}
+	}
+
+	if err := auditLogger.Close(); err != nil {
+		t.Errorf("Failed to close audit log: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Errorf("Failed to parse audit record %q: %v", scanner.Text(), err)
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) != len(results) {
+		t.Fatalf("Expected %d audit records but found %d.", len(results), len(records))
+	}
+
+	expected := []auditRecord{
+		{Source: "192.0.2.10", Result: "available"},
+		{Source: "192.0.2.10", Result: "notready", Reason: "wsrep_not_ready"},
+	}
+
+	for i, record := range records {
+		if record.Time == "" {
+			t.Errorf("Expected audit record %d to have a timestamp.", i)
+		}
+
+		record.Time = ""
+		if record != expected[i] {
+			t.Errorf("Expected audit record %+v but received %+v.", expected[i], record)
+		}
+	}
+}
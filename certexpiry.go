@@ -0,0 +1,99 @@
+/*
+Certexpiry.go warns ahead of the expiry of the TLS client certificate.
+*/
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// certExpiryLogInterval is how often a warning about an expiring certificate is
+// logged, so frequent probing does not flood the logs.
+const certExpiryLogInterval = time.Hour
+
+// CertExpiry tracks the expiry of the TLS client certificate, so a failed
+// certificate rotation is noticed before the database server rejects connections.
+type CertExpiry struct {
+	notAfter time.Time
+	warning  time.Duration
+
+	mu       sync.Mutex
+	warnedAt time.Time
+}
+
+// NewCertExpiry reads the expiry of the client certificate at connection.tls.cert,
+// or returns nil if connection.tls.expiry_warning is not set or no client
+// certificate is configured.
+func NewCertExpiry(config *viper.Viper) *CertExpiry {
+	warning := config.GetDuration("connection.tls.expiry_warning")
+	if warning <= 0 || !config.IsSet("connection.tls.cert") || !config.IsSet("connection.tls.key") {
+		return nil
+	}
+
+	notAfter, err := readCertExpiry(config.GetString("connection.tls.cert"))
+	if err != nil {
+		logrus.Errorf("Error reading client certificate expiry: %v", err)
+		return nil
+	}
+
+	return &CertExpiry{notAfter: notAfter, warning: warning}
+}
+
+// readCertExpiry returns the expiry of the first certificate in the PEM file at path.
+func readCertExpiry(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM data found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return cert.NotAfter, nil
+}
+
+// Remaining returns the time left until the certificate expires, which is
+// negative once it has expired.
+func (c *CertExpiry) Remaining() time.Duration {
+	return time.Until(c.notAfter)
+}
+
+// Check logs a warning if the certificate expires within the warning period.  The
+// warning is repeated at most every certExpiryLogInterval.
+func (c *CertExpiry) Check() {
+	remaining := c.Remaining()
+	if remaining > c.warning {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.warnedAt.IsZero() && time.Since(c.warnedAt) < certExpiryLogInterval {
+		return
+	}
+
+	c.warnedAt = time.Now()
+
+	if remaining <= 0 {
+		logrus.Errorf("TLS client certificate expired on %s.", c.notAfter.Format(time.RFC3339))
+	} else {
+		logrus.Warnf("TLS client certificate expires on %s, in %s.", c.notAfter.Format(time.RFC3339),
+			remaining.Truncate(time.Minute))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// writeClientCert writes a self-signed certificate expiring at notAfter and
+// returns its path.
+func writeClientCert(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "healthcheck"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "client_cert.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	return path
+}
+
+func TestNewCertExpiry(t *testing.T) {
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	config := viper.New()
+	config.Set("connection.tls.cert", writeClientCert(t, notAfter))
+	config.Set("connection.tls.key", "client_key.pem")
+
+	if certExpiry := NewCertExpiry(config); certExpiry != nil {
+		t.Error("Expected the certificate expiry not to be tracked without connection.tls.expiry_warning.")
+	}
+
+	config.Set("connection.tls.expiry_warning", "48h")
+
+	certExpiry := NewCertExpiry(config)
+	if certExpiry == nil {
+		t.Fatal("Expected the certificate expiry to be tracked.")
+	}
+
+	if !certExpiry.notAfter.Equal(notAfter) {
+		t.Errorf("Expected expiry %s but received %s.", notAfter, certExpiry.notAfter)
+	}
+
+	if remaining := certExpiry.Remaining(); remaining <= 23*time.Hour || remaining > 24*time.Hour {
+		t.Errorf("Expected about 24h until expiry but received %s.", remaining)
+	}
+}
+
+func TestCertExpiryCheck(t *testing.T) {
+	certExpiry := &CertExpiry{notAfter: time.Now().Add(24 * time.Hour), warning: time.Hour}
+	certExpiry.Check()
+
+	if !certExpiry.warnedAt.IsZero() {
+		t.Error("Expected no warning for a certificate outside the warning period.")
+	}
+
+	certExpiry.warning = 48 * time.Hour
+	certExpiry.Check()
+
+	warnedAt := certExpiry.warnedAt
+	if warnedAt.IsZero() {
+		t.Fatal("Expected a warning for a certificate within the warning period.")
+	}
+
+	certExpiry.Check()
+
+	if certExpiry.warnedAt != warnedAt {
+		t.Error("Expected the warning not to be repeated within the log interval.")
+	}
+}
@@ -4,8 +4,12 @@ Config.go provides the program configuration using the Viper library.
 package main
 
 import (
+	"errors"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -14,28 +18,85 @@ import (
 const (
 	defaultDatabasePort = 3306
 	defaultHTTPPort     = 5678
+
+	defaultCustomResultMaxLength = 4096
+
+	defaultWriterHostgroup = 10
+	defaultReaderHostgroup = 20
 )
 
-// CreateConfig creates a new config instance.
-func CreateConfig() *viper.Viper {
-	config := viper.New()
-	config.SetConfigName(AppName)
+// httpPathKeys lists the config keys holding URI paths of HTTP endpoints.
+var httpPathKeys = []string{
+	"http.path",
+	"http.weight_path",
+	"http.wsrep_state_path",
+	"http.proxysql_path",
+	"http.metrics_path",
+	"http.cluster_path",
+	"http.stats_path",
+	"http.liveness_path",
+	"http.readiness_path",
+	"http.detail_path",
+	"http.status_path",
+}
 
-	workingDir, err := os.Getwd()
-	if err != nil {
-		logrus.Fatal(err)
-	}
+// deprecatedKeys lists the config keys which were renamed, along with their
+// replacement.  Deprecated keys keep working, but a warning is logged when they are
+// found in the config file.
+var deprecatedKeys = []struct {
+	key         string
+	replacement string
+}{
+	{"connection.tls.enforced", "connection.tls.required"},
+	{"connection.conn_max_idle_time", "connection.pool.conn_max_idle_time"},
+	{"http.last_error_token", "http.admin_token"},
+	{"http.override_token", "http.admin_token"},
+	{"http.detail_token", "http.admin_token"},
+}
 
-	config.AddConfigPath(workingDir)
+// keyAliases lists alternative names accepted for config keys.  Unlike deprecated
+// keys, they are not warned about.
+var keyAliases = []struct {
+	key    string
+	target string
+}{
+	{"connection.database", "connection.dbname"},
+}
+
+// defaultConnectionWarning logs the warning about a default connection without
+// credentials once, rather than again on every reload.
+var defaultConnectionWarning sync.Once
+
+// CreateConfig creates a new config instance.  If path is set, the config is read
+// from that file, which must exist, rather than searched in the default locations.
+func CreateConfig(path string) *viper.Viper {
+	config := viper.New()
+
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			logrus.Fatalf("Error reading config file %s: %v", path, err)
+		}
 
-	if runtime.GOOS == "windows" {
-		config.AddConfigPath(os.Getenv("PROGRAMFILES"))
-		config.AddConfigPath(os.Getenv("LOCALAPPDATA"))
+		config.SetConfigFile(path)
 	} else {
-		config.AddConfigPath("/etc/sysconfig")
-		config.AddConfigPath("/etc/default")
-		config.AddConfigPath("/etc")
-		config.AddConfigPath("$HOME/.config")
+		config.SetConfigName(AppName)
+
+		workingDir, err := os.Getwd()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		config.AddConfigPath(workingDir)
+
+		if runtime.GOOS == "windows" {
+			config.AddConfigPath(os.Getenv("PROGRAMFILES"))
+			config.AddConfigPath(os.Getenv("LOCALAPPDATA"))
+		} else {
+			config.AddConfigPath("/etc/sysconfig")
+			config.AddConfigPath("/etc/default")
+			config.AddConfigPath("/etc")
+			config.AddConfigPath("$HOME/.config")
+		}
 	}
 
 	if err := config.ReadInConfig(); err != nil { // Handle errors reading the config file.
@@ -44,6 +105,9 @@ func CreateConfig() *viper.Viper {
 		}
 	}
 
+	applyDeprecatedKeys(config)
+	applyKeyAliases(config)
+
 	if len(config.ConfigFileUsed()) == 0 {
 		logrus.Warn("No config file found.  Using default configuration!")
 	} else if logrus.IsLevelEnabled(logrus.DebugLevel) {
@@ -52,22 +116,181 @@ func CreateConfig() *viper.Viper {
 
 	config.SetDefault("connection.host", "localhost")
 	config.SetDefault("connection.port", defaultDatabasePort)
-	config.SetDefault("connection.tls.enforced", false)
+	config.SetDefault("connection.tls.required", false)
 	config.SetDefault("connection.tls.skip-verify", false)
+	config.SetDefault("connection.tls.session_resumption", true)
+	config.SetDefault("connection.tls.expiry_warning", "0s")
+	config.SetDefault("connection.disable_prepared_statements", false)
+	config.SetDefault("connection.parse_time", false)
+	config.SetDefault("connection.interpolate_params", false)
+	config.SetDefault("connection.pool.max_open_conns", databaseMaxOpenConns)
+	config.SetDefault("connection.pool.max_idle_conns", databaseMaxIdleConns)
+	config.SetDefault("connection.pool.conn_max_lifetime", databaseConnMaxLifetime)
+	config.SetDefault("connection.pool.conn_max_idle_time", databaseConnMaxIdleTime)
+	config.SetDefault("connection.pool.standalone_single_connection", true)
 	config.SetDefault("http.addr", "::")
 	config.SetDefault("http.port", defaultHTTPPort)
+	config.SetDefault("http.network", "tcp")
 	config.SetDefault("http.path", "/")
+	config.SetDefault("http.metrics_path", "/metrics")
+	config.SetDefault("http.keep_alive", false)
+	config.SetDefault("http.enable_h2c", false)
+	config.SetDefault("http.rate_limit", 0)
+	config.SetDefault("http.rate_limit_burst", 1)
+	config.SetDefault("http.response_format", "text")
+	config.SetDefault("http.response_mode", "default")
+	config.SetDefault("http.standby_status_code", 200)
+	config.SetDefault("http.format_from_extension", false)
+	config.SetDefault("http.include_cluster_info", false)
+	config.SetDefault("http.include_last_error", false)
+	config.SetDefault("http.shutdown_summary", false)
+	config.SetDefault("http.allow_header_overrides", false)
+	config.SetDefault("http.json_key_style", "snake")
+	config.SetDefault("grpc.addr", "::")
+	config.SetDefault("audit.enabled", false)
+	config.SetDefault("log.format", logFormatText)
+	config.SetDefault("log.level", logrus.InfoLevel.String())
+	config.SetDefault("statsd.enabled", false)
+	config.SetDefault("statsd.addr", "127.0.0.1:8125")
+	config.SetDefault("statsd.prefix", "mysql_healthcheck.")
+	config.SetDefault("customResultRowMode", "first_row")
+	config.SetDefault("customQueryArgs", []string{})
+	config.SetDefault("customResultMaxLength", defaultCustomResultMaxLength)
+	config.SetDefault("options.validate_on_create", false)
+	config.SetDefault("options.available_states", []string{"synced"})
 	config.SetDefault("options.available_when_donor", false)
 	config.SetDefault("options.available_when_readonly", false)
+	config.SetDefault("options.slow_start_duration", "0s")
+	config.SetDefault("options.concurrent_checks", false)
+	config.SetDefault("options.success_threshold", 1)
+	config.SetDefault("options.result_window", 1)
+	config.SetDefault("options.check_clone_status", false)
+	config.SetDefault("options.detect_eviction", false)
+	config.SetDefault("options.detect_disk_full", false)
+	config.SetDefault("options.require_binlog", false)
+	config.SetDefault("options.detect_sst", false)
+	config.SetDefault("options.check_timeout", "2s")
+	config.SetDefault("options.custom_query_timeout", "0s")
+	config.SetDefault("options.startup_grace_period", "0s")
+	config.SetDefault("options.retry_attempts", 1)
+	config.SetDefault("options.retry_delay", "100ms")
+	config.SetDefault("options.cache_ttl", "0s")
+	config.SetDefault("options.honor_offline_mode", true)
+	config.SetDefault("options.cluster_min_size", 1)
+	config.SetDefault("options.require_quorum", false)
+	config.SetDefault("options.require_primary_component", true)
+	config.SetDefault("options.latency_window", defaultLatencyWindow)
+	config.SetDefault("options.exclude_coldstart_from_metrics", 0)
+	config.SetDefault("options.max_clock_skew", "0s")
+	config.SetDefault("options.fail_on_clock_skew", false)
+	config.SetDefault("options.commit_progress_window", "0s")
+	config.SetDefault("options.max_seqno_gap", 0)
+	config.SetDefault("options.circuit_breaker_threshold", 0)
+	config.SetDefault("options.circuit_breaker_cooldown", "30s")
+	config.SetDefault("options.pre_check.timeout", defaultPreCheckTimeout)
+	config.SetDefault("options.max_replication_lag", 0)
+	config.SetDefault("options.check_mode", checkModeDefault)
+	config.SetDefault("options.cluster_mode", clusterModeGalera)
+	config.SetDefault("options.role", rolePrimary)
+	config.SetDefault("options.read_write.table", "healthcheck.scratch")
+	config.SetDefault("options.read_write.timeout", "1s")
+	config.SetDefault("options.heartbeat.column", "ts")
+	config.SetDefault("options.heartbeat.max_lag", "10s")
+	config.SetDefault("proxysql.writer_hostgroup", defaultWriterHostgroup)
+	config.SetDefault("proxysql.reader_hostgroup", defaultReaderHostgroup)
+
+	for _, key := range httpPathKeys {
+		if !config.IsSet(key) {
+			continue
+		}
 
-	// HTTP path must contain leading slash.
-	if config.GetString("http.path") != "/" {
-		pathRune := []rune(config.GetString("http.path"))
-		if string(pathRune[0:1]) != "/" {
-			// Provided path does not begin with leading slash.
-			config.Set("http.path", "/"+config.GetString("http.path"))
+		path, err := normalizeHTTPPath(config.GetString(key))
+		if err != nil {
+			logrus.Fatalf("Invalid %s: %v", key, err)
 		}
+
+		config.Set(key, path)
+	}
+
+	if usesDefaultConnection(config) {
+		defaultConnectionWarning.Do(func() {
+			logrus.Warnf("Connecting to localhost:%d without credentials, so health checks will likely fail.  "+
+				"Check that a %s config file is in one of the supported locations and sets connection.user, "+
+				"or ignore this warning if the database server accepts unauthenticated local connections.",
+				defaultDatabasePort, AppName)
+		})
 	}
 
 	return config
 }
+
+// applyDeprecatedKeys warns about every deprecated key set in the config file,
+// naming its replacement, and carries its value over to the replacement unless
+// that is set too.  The deprecated keys are then registered as aliases, so they
+// also work when set at runtime.  It must be called after the config file is read
+// and before the aliases are registered, since a nested alias hides its key from
+// the config file.
+func applyDeprecatedKeys(config *viper.Viper) {
+	for _, deprecated := range deprecatedKeys {
+		if config.InConfig(deprecated.key) {
+			if config.InConfig(deprecated.replacement) {
+				logrus.Warnf("Config key %s is deprecated and ignored since %s is set, remove it",
+					deprecated.key, deprecated.replacement)
+			} else {
+				logrus.Warnf("Config key %s is deprecated, use %s instead", deprecated.key, deprecated.replacement)
+				config.Set(deprecated.replacement, config.Get(deprecated.key))
+			}
+		}
+
+		config.RegisterAlias(deprecated.key, deprecated.replacement)
+	}
+}
+
+// applyKeyAliases carries the value of every alias set in the config file over to
+// its target unless that is set too, and registers the aliases, as
+// applyDeprecatedKeys does for deprecated keys.
+func applyKeyAliases(config *viper.Viper) {
+	for _, alias := range keyAliases {
+		if config.InConfig(alias.key) && !config.InConfig(alias.target) {
+			config.Set(alias.target, config.Get(alias.key))
+		}
+
+		config.RegisterAlias(alias.key, alias.target)
+	}
+}
+
+// usesDefaultConnection reports whether config connects to the default database
+// server without any credentials, which usually means the config file is missing
+// or misplaced rather than that the database server allows anonymous access.
+func usesDefaultConnection(config *viper.Viper) bool {
+	return config.GetString("connection.host") == "localhost" &&
+		config.GetInt("connection.port") == defaultDatabasePort &&
+		!config.IsSet("connection.unix_socket") &&
+		!config.IsSet("connection.user") &&
+		!config.IsSet("connection.password") &&
+		!config.IsSet("connection.password_file")
+}
+
+// normalizeHTTPPath trims surrounding whitespace from a URI path, adds the leading
+// slash if missing and collapses duplicate slashes, so the path matches what
+// balancers request.  Paths with a query string, fragment or inner whitespace
+// are rejected, since they can never match a request path.
+func normalizeHTTPPath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+
+	if strings.ContainsAny(path, "?#") {
+		return "", errors.New("path must not contain a query string or fragment")
+	}
+
+	if strings.IndexFunc(path, unicode.IsSpace) >= 0 {
+		return "", errors.New("path must not contain whitespace")
+	}
+
+	path = "/" + path
+
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+
+	return path, nil
+}
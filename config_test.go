@@ -1,9 +1,18 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/viper"
+)
 
 func TestCreateConfig(t *testing.T) {
-	config := CreateConfig()
+	config := CreateConfig("")
 	// Validate creation of basic config with defaults
 	if config == nil {
 		t.Error("Received nil object from CreateConfig()")
@@ -14,3 +23,133 @@ func TestCreateConfig(t *testing.T) {
 		t.Error("No default values found in config.")
 	}
 }
+
+func TestNormalizeHTTPPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+		valid    bool
+	}{
+		{"/", "/", true},
+		{"", "/", true},
+		{"health", "/health", true},
+		{"/health", "/health", true},
+		{"//health", "/health", true},
+		{"/health ", "/health", true},
+		{" /status//health/ ", "/status/health/", true},
+		{"/health?x=1", "", false},
+		{"/health#top", "", false},
+		{"/my health", "", false},
+	}
+
+	for _, test := range tests {
+		path, err := normalizeHTTPPath(test.path)
+
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("Expected path %q to be valid but received error: %v", test.path, err)
+		case !test.valid && err == nil:
+			t.Errorf("Expected path %q to be rejected but received %q.", test.path, path)
+		case path != test.expected:
+			t.Errorf("Expected path %q to be normalized to %q but received %q.", test.path, test.expected, path)
+		}
+	}
+}
+
+func TestUsesDefaultConnection(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    string
+		expected bool
+	}{
+		{"", "", true},
+		{"connection.user", "healthcheck", false},
+		{"connection.password_file", "/run/secrets/mysql", false},
+		{"connection.host", "db1.example.com", false},
+		{"connection.port", "3307", false},
+		{"connection.unix_socket", "/var/run/mysqld/mysqld.sock", false},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig("")
+		if test.key != "" {
+			config.Set(test.key, test.value)
+		}
+
+		if result := usesDefaultConnection(config); result != test.expected {
+			t.Errorf("Expected default connection %t with %s set but received %t.", test.expected, test.key, result)
+		}
+	}
+}
+
+func TestApplyDeprecatedKeys(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+
+	err := config.ReadConfig(strings.NewReader(`
+connection:
+  conn_max_idle_time: 30s
+  tls:
+    enforced: true
+    required: false
+http:
+  last_error_token: secret
+  override_token: secret
+  detail_token: secret
+`))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	hook := logrustest.NewGlobal()
+	defer hook.Reset()
+
+	applyDeprecatedKeys(config)
+
+	if idleTime := config.GetDuration("connection.pool.conn_max_idle_time"); idleTime != 30*time.Second {
+		t.Errorf("Expected connection.conn_max_idle_time to set the pool idle time but received %s.", idleTime)
+	}
+
+	if token := config.GetString("http.admin_token"); token != "secret" {
+		t.Errorf("Expected the former tokens to set http.admin_token but received %q.", token)
+	}
+
+	if config.GetBool("connection.tls.required") {
+		t.Error("Expected connection.tls.enforced to be ignored since connection.tls.required is set.")
+	}
+
+	if warnings := len(hook.AllEntries()); warnings != len(deprecatedKeys) {
+		t.Errorf("Expected %d deprecation warnings but received %d.", len(deprecatedKeys), warnings)
+	}
+}
+
+func TestCreateConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "healthcheck.yaml")
+
+	err := os.WriteFile(path, []byte("connection:\n  host: db1.example.com\n  port: 3307\nhttp:\n  path: /status\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config := CreateConfig(path)
+
+	if config.ConfigFileUsed() != path {
+		t.Errorf("Expected config to be read from %s but received %s.", path, config.ConfigFileUsed())
+	}
+
+	if host := config.GetString("connection.host"); host != "db1.example.com" {
+		t.Errorf("Expected connection.host from the config file but received %s.", host)
+	}
+
+	if port := config.GetInt("connection.port"); port != 3307 {
+		t.Errorf("Expected connection.port from the config file but received %d.", port)
+	}
+
+	if path := config.GetString("http.path"); path != "/status" {
+		t.Errorf("Expected http.path from the config file but received %s.", path)
+	}
+
+	if port := config.GetInt("http.port"); port != defaultHTTPPort {
+		t.Errorf("Expected the default http.port but received %d.", port)
+	}
+}
@@ -4,12 +4,21 @@ Database.go provides the connection and health checking logic for the target dat
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -19,9 +28,109 @@ import (
 
 // DBHandler encapsulates all required objects to manage a database connection and run status checks.
 type DBHandler struct {
-	db                    *sql.DB
-	availableWhenDonor    bool
-	availableWhenReadOnly bool
+	db                        *sql.DB
+	validationQuery           string
+	customQuery               string
+	customQueryArgs           []interface{}
+	customResult              string
+	customResultRowMode       string
+	customResultMaxLength     int
+	customQueryTimeout        time.Duration
+	customChecks              []customCheck
+	dbName                    string
+	password                  string
+	disablePreparedStatements bool
+	availableStates           map[WsrepStatus]bool
+	availableWhenReadOnly     bool
+	slowStartDuration         time.Duration
+	concurrentChecks          bool
+	successThreshold          int
+	heartbeatTable            string
+	heartbeatColumn           string
+	heartbeatMaxLag           time.Duration
+	maxReplicationLag         int
+	checkMode                 string
+	standby                   bool
+	clusterMode               string
+	scratchTable              string
+	readWriteTimeout          time.Duration
+	checkCloneStatus          bool
+	detectEviction            bool
+	detectDiskFull            bool
+	requireBinlog             bool
+	detectSST                 bool
+	checkTimeout              time.Duration
+	retryAttempts             int
+	retryDelay                time.Duration
+	honorOfflineMode          bool
+	clusterMinSize            int
+	requireQuorum             bool
+	requirePrimaryComponent   bool
+	maxClockSkew              time.Duration
+	failOnClockSkew           bool
+	commitProgressWindow      time.Duration
+	maxSeqnoGap               int64
+	circuitBreakerThreshold   int
+	circuitBreakerCooldown    time.Duration
+	startupGraceUntil         time.Time
+	latencies                 *LatencyWindow
+	coldStartChecks           int
+	preCheck                  *PreCheck
+	maintenanceFile           string
+	resultWindow              *ResultWindow
+	certExpiry                *CertExpiry
+	cacheTTL                  time.Duration
+
+	// cacheMu is held for the whole of a check when caching, apart from mu which
+	// the check itself takes.
+	cacheMu      sync.Mutex
+	cachedResult CheckResult
+	cachedAt     time.Time
+
+	mu                sync.Mutex
+	checked           bool
+	availableSince    time.Time
+	successStreak     int
+	clusterInfo       *ClusterInfo
+	clusterInfoAt     time.Time
+	lastCommitted     int64
+	lastCommittedAt   time.Time
+	unavailableStreak int
+	circuitOpenUntil  time.Time
+	wsrepState        WsrepStatus
+	wsrepStateKnown   bool
+	lastError         *LastError
+	checksRun         int
+	detail            *StatusDetail
+	detailAt          time.Time
+
+	// customQueryDuration is the duration of the last run of customQuery.
+	customQueryDuration time.Duration
+	customQueryRun      bool
+}
+
+// customCheck is a query of the custom checks, whose result must match for the node
+// to be available.
+type customCheck struct {
+	query          string
+	args           []interface{}
+	expectedResult string
+}
+
+// ClusterInfo describes the wsrep cluster as seen by the local node.
+type ClusterInfo struct {
+	Size       int    `json:"size"`
+	Status     string `json:"status"`
+	LocalIndex int    `json:"local_index"`
+	StateUUID  string `json:"state_uuid"`
+}
+
+// LastError is a sanitized database error, reported to authenticated clients to
+// debug failing checks without reading the logs.
+type LastError struct {
+	Number  uint16    `json:"number,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
 }
 
 // WsrepStatus represents the state of the wsrep process on the database server.
@@ -30,15 +139,176 @@ type WsrepStatus int
 // ServerStatus represents the state of the database server.
 type ServerStatus int
 
-var customQuery string
-var customResult string
+// String returns a stable machine-readable name for the status.
+func (s ServerStatus) String() string {
+	switch s {
+	case Available:
+		return "available"
+	case ReadOnly:
+		return "readonly"
+	case NotReady:
+		return "notready"
+	case Unavailable:
+		return "unavailable"
+	case Lagging:
+		return "lagging"
+	case Evicted:
+		return "evicted"
+	case Standby:
+		return "standby"
+	}
+
+	return "unknown"
+}
+
+// Reason identifies the specific cause of a ServerStatus, when one is known.
+type Reason string
+
+// CheckResult holds the outcome of a health check on the database server.
+type CheckResult struct {
+	Status ServerStatus
+	Reason Reason
+}
+
+// driverParams maps the DSN parameters of the MySQL driver, lowercased as viper
+// returns the keys of connection.params, to their actual names.  Other parameters
+// are system variables, whose names are case-insensitive.
+var driverParams = func() map[string]string {
+	names := []string{
+		"allowAllFiles", "allowCleartextPasswords", "allowFallbackToPlaintext", "allowNativePasswords",
+		"allowOldPasswords", "charset", "checkConnLiveness", "clientFoundRows", "collation", "columnsWithAlias",
+		"compress", "connectionAttributes", "interpolateParams", "loc", "maxAllowedPacket", "multiStatements",
+		"parseTime", "readTimeout", "rejectReadOnly", "serverPubKey", "timeTruncate", "timeout", "tls",
+		"writeTimeout",
+	}
+
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		params[strings.ToLower(name)] = name
+	}
+
+	return params
+}()
+
+// managedParams are the DSN parameters set from other config keys, which
+// connection.params must not override.
+var managedParams = map[string]string{
+	"tls":                  "connection.tls",
+	"connectionAttributes": "connection.attributes",
+}
+
+// customTLSRegistered records whether a TLS config was registered under
+// customTLSConfigName by a previous call to BuildDSN.
+var customTLSRegistered bool
 
 const (
 	databaseMaxOpenConns    = 5
+	databaseMaxIdleConns    = 2
 	databaseConnMaxLifetime = time.Minute * 5
+	databaseConnMaxIdleTime = time.Minute
+
+	// maxConnAttrKeyLength and maxConnAttrValueLength are the lengths beyond which
+	// MySQL truncates connection attribute keys and values.
+	maxConnAttrKeyLength   = 32
+	maxConnAttrValueLength = 1024
+
+	// customTLSConfigName is the name the TLS config built from connection.tls is
+	// registered under with the MySQL driver.
+	customTLSConfigName = "custom"
+
+	// maxLastErrorLength is the length beyond which the message of a LastError is truncated.
+	maxLastErrorLength = 200
+
+	// tlsSessionCacheSize is the number of TLS sessions cached for resumption.
+	tlsSessionCacheSize = 16
+
+	// clusterInfoTTL is how long cluster info is cached for, to avoid extra load
+	// under frequent probing.
+	clusterInfoTTL = 5 * time.Second
+
+	// rowModeFirstRow only compares the first row of the custom query result.
+	rowModeFirstRow = "first_row"
+	// rowModeAllMatch requires every row of the custom query result to match.
+	rowModeAllMatch = "all_match"
+	// rowModeAnyMatch requires at least one row of the custom query result to match.
+	rowModeAnyMatch = "any_match"
+
+	// checkModeDefault runs the wsrep or custom query checks only.
+	checkModeDefault = "default"
+	// checkModeReadWrite additionally requires an available node to pass a read and a write probe.
+	checkModeReadWrite = "read_write"
+	// checkModePrimaryOnly additionally requires an available node to be writable,
+	// and the PRIMARY of its group in group_replication cluster mode.
+	checkModePrimaryOnly = "primary_only"
+
+	// rolePrimary reports healthy nodes as available.
+	rolePrimary = "primary"
+	// roleStandby reports healthy nodes as standby.
+	roleStandby = "standby"
+
+	// clusterModeGalera checks the node as a member of a Galera cluster, by its wsrep state.
+	clusterModeGalera = "galera"
+	// clusterModeGroupReplication checks the node as a member of a MySQL Group
+	// Replication group, such as an InnoDB Cluster, by its member state.
+	clusterModeGroupReplication = "group_replication"
+	// clusterModeStandalone checks a server which is not part of a cluster, by
+	// whether it answers a query at all.
+	clusterModeStandalone = "standalone"
+
+	// groupMemberOnline is the MEMBER_STATE of a Group Replication member which is
+	// in sync with its group, the equivalent of Synced.
+	groupMemberOnline = "ONLINE"
+	// groupMemberOffline is the MEMBER_STATE of a server which is not part of a group.
+	groupMemberOffline = "OFFLINE"
+	// groupMemberPrimary is the MEMBER_ROLE of a Group Replication member accepting writes.
+	groupMemberPrimary = "PRIMARY"
+
+	// minWeight is the weight reported at the start of a slow-start ramp.
+	minWeight = 1
+	// maxWeight is the weight reported by a fully available node.
+	maxWeight = 100
 
 	// wsrepLocalStateQuery returns status of local wsrep instance.
 	wsrepLocalStateQuery = "SHOW STATUS LIKE 'wsrep_local_state';"
+	// wsrepStateCommentQuery returns the description of the state of the local wsrep instance.
+	wsrepStateCommentQuery = "SHOW STATUS LIKE 'wsrep_local_state_comment';"
+	// wsrepStatusQuery returns all wsrep status variables of the local instance.
+	wsrepStatusQuery = "SHOW STATUS LIKE 'wsrep_%';"
+	// heartbeatQuery returns the age in microseconds of the latest heartbeat, given
+	// the timestamp column and heartbeat table.
+	heartbeatQuery = "SELECT TIMESTAMPDIFF(MICROSECOND, MAX(%s), UTC_TIMESTAMP(6)) FROM %s;"
+	// cloneStatusQuery returns the state of the latest MySQL clone plugin operation.
+	cloneStatusQuery = "SELECT STATE FROM performance_schema.clone_status ORDER BY ID DESC LIMIT 1;"
+	// diskFullQuery counts the disk full errors logged by the server within the last
+	// hour.  Requires performance_schema.error_log from MySQL 8.0.22.
+	diskFullQuery = "SELECT COUNT(*) FROM performance_schema.error_log " +
+		"WHERE LOGGED > NOW(6) - INTERVAL 1 HOUR AND DATA LIKE '%disk is full%';"
+	// groupMemberStateQuery returns the Group Replication member state of the local server.
+	groupMemberStateQuery = "SELECT MEMBER_STATE FROM performance_schema.replication_group_members " +
+		"WHERE MEMBER_ID = @@GLOBAL.server_uuid;"
+	// groupMemberRoleQuery returns the Group Replication member role of the local server.
+	groupMemberRoleQuery = "SELECT MEMBER_ROLE FROM performance_schema.replication_group_members " +
+		"WHERE MEMBER_ID = @@GLOBAL.server_uuid;"
+	// groupMembersQuery counts the online members of the MySQL Group Replication group.
+	groupMembersQuery = "SELECT COUNT(*) FROM performance_schema.replication_group_members WHERE MEMBER_STATE = 'ONLINE';"
+	// logBinQuery determines if binary logging is enabled on the server.
+	logBinQuery = "SELECT @@GLOBAL.log_bin;"
+	// offlineModeQuery determines if an operator took the server out of service with offline_mode.
+	offlineModeQuery = "SELECT @@GLOBAL.offline_mode;"
+	// currentDatabaseQuery returns the default database of the connection, which is
+	// NULL once that database has been dropped.
+	currentDatabaseQuery = "SELECT DATABASE();"
+	// serverTimeQuery returns the database server's clock as fractional seconds since the epoch.
+	serverTimeQuery = "SELECT UNIX_TIMESTAMP(NOW(6));"
+	// slaveStatusQuery returns the state of the replication threads of an async replica.
+	slaveStatusQuery = "SHOW SLAVE STATUS;"
+	// secondsBehindMasterColumn is the column of slaveStatusQuery holding the replication lag.
+	secondsBehindMasterColumn = "Seconds_Behind_Master"
+	// readProbeQuery is the read probe of the read_write check mode.
+	readProbeQuery = "SELECT 1;"
+	// writeProbeQuery is the write probe of the read_write check mode, given the
+	// scratch table.  It is always rolled back.
+	writeProbeQuery = "INSERT INTO %s () VALUES ();"
 	// readOnlyQuery determines if node is in read-only mode.
 	readOnlyQuery = "SHOW GLOBAL VARIABLES LIKE 'read_only';"
 
@@ -47,7 +317,7 @@ const (
 	// Donor means the node is providing SST to a joining node.
 	Donor WsrepStatus = 2
 	// Joined means the node has received the SST but is not synced yet.
-	Joined WsrepStatus = 3 //nolint // Not explicitly used yet, but here for reference
+	Joined WsrepStatus = 3
 	// Synced means the node is in the cluster and fully operational.
 	Synced WsrepStatus = 4
 
@@ -59,31 +329,291 @@ const (
 	NotReady ServerStatus = 3
 	// Unavailable means we are unable to connect to the node.
 	Unavailable ServerStatus = 4
+	// Lagging means the node is serving stale data.
+	Lagging ServerStatus = 5
+	// Evicted means the node was fenced by the cluster and must be restarted.
+	Evicted ServerStatus = 6
+	// Standby means the node is healthy but configured as the passive node of an
+	// active/passive setup, to be kept as a backup target.
+	Standby ServerStatus = 7
+
+	// ReasonWsrepNotReady means the node is rejecting queries because wsrep is not ready.
+	ReasonWsrepNotReady Reason = "wsrep_not_ready"
+	// ReasonRecovering means the node has not yet passed enough consecutive checks to be available.
+	ReasonRecovering Reason = "recovering"
+	// ReasonHeartbeatMissing means no heartbeat could be read to determine the freshness of the node.
+	ReasonHeartbeatMissing Reason = "heartbeat_missing"
+	// ReasonAuth means the database server rejected our credentials.
+	ReasonAuth Reason = "auth"
+	// ReasonStarting means the database server is not accepting connections yet during startup.
+	ReasonStarting Reason = "starting"
+	// ReasonCloneInProgress means the node is being provisioned by the MySQL clone plugin.
+	ReasonCloneInProgress Reason = "clone_in_progress"
+	// ReasonCloneFailed means provisioning the node with the MySQL clone plugin failed.
+	ReasonCloneFailed Reason = "clone_failed"
+	// ReasonClockSkew means the database server's clock is too far from the local clock.
+	ReasonClockSkew Reason = "clock_skew"
+	// ReasonEvicted means the node's UUID is on the cluster's EVS evict list.
+	ReasonEvicted Reason = "evicted"
+	// ReasonDiskFull means the node is read-only after recently running out of disk space.
+	ReasonDiskFull Reason = "disk_full"
+	// ReasonNoQuorum means the node is the only member of its primary component.
+	ReasonNoQuorum Reason = "no_quorum"
+	// ReasonDatabaseMissing means the database server is up but the configured
+	// connection.dbname does not exist.
+	ReasonDatabaseMissing Reason = "database_missing"
+	// ReasonOfflineMode means an operator is draining the node by setting offline_mode.
+	ReasonOfflineMode Reason = "offline_mode"
+	// ReasonReadFailed means the read probe of the read_write check mode failed.
+	ReasonReadFailed Reason = "read_failed"
+	// ReasonWriteFailed means the write probe of the read_write check mode failed.
+	ReasonWriteFailed Reason = "write_failed"
+	// ReasonResultTooLarge means a value returned by customQuery exceeds customResultMaxLength.
+	ReasonResultTooLarge Reason = "result_too_large"
+	// ReasonReplicationLag means the node is an async replica lagging behind its source.
+	ReasonReplicationLag Reason = "replication_lag"
+	// ReasonReplicationStopped means the node is an async replica whose replication
+	// lag is unknown, since replication is stopped or broken.
+	ReasonReplicationStopped Reason = "replication_stopped"
+	// ReasonSeqnoGap means the node has received more write-sets than
+	// options.max_seqno_gap beyond its last committed one.
+	ReasonSeqnoGap Reason = "seqno_gap"
+	// ReasonPreCheckFailed means a local pre-check of the host failed, so the
+	// database server was not queried.
+	ReasonPreCheckFailed Reason = "pre_check_failed"
+	// ReasonCircuitOpen means the database server was not queried because it was
+	// recently found to be unavailable several times in a row.
+	ReasonCircuitOpen Reason = "circuit_open"
+	// ReasonStalled means the node is synced but has stopped applying replicated transactions.
+	ReasonStalled Reason = "stalled"
+	// ReasonReceivingSST means the node is joining the cluster and receiving a
+	// State Snapshot Transfer, so it is busy rather than broken.
+	ReasonReceivingSST Reason = "receiving_sst"
+	// ReasonNotPrimary means the node cannot take writes in the primary_only check mode.
+	ReasonNotPrimary Reason = "not_primary"
+	// ReasonBinlogDisabled means a writable node has binary logging disabled, so
+	// its writes cannot be replicated.
+	ReasonBinlogDisabled Reason = "binlog_disabled"
+	// ReasonNonPrimaryComponent means the node is synced but its cluster component
+	// lost quorum, so it must not take writes.
+	ReasonNonPrimaryComponent Reason = "non_primary_component"
+	// ReasonMaintenance means an operator is draining the node by creating
+	// options.maintenance_file.
+	ReasonMaintenance Reason = "maintenance"
+
+	// clusterPrimary is the wsrep_cluster_status of a cluster component with quorum.
+	clusterPrimary = "Primary"
+
+	// receivingSSTComment is the part of wsrep_local_state_comment which shows a
+	// joining node receiving a State Snapshot Transfer.
+	receivingSSTComment = "receiving state transfer"
+
+	// cloneInProgress is the clone_status state of a running clone operation.
+	cloneInProgress = "In Progress"
+	// cloneFailed is the clone_status state of a failed clone operation.
+	cloneFailed = "Failed"
+
+	// errAccessDenied is the MySQL error number (ER_ACCESS_DENIED_ERROR) returned
+	// when authentication fails.
+	errAccessDenied = 1045
+	// errBadDB is the MySQL error number (ER_BAD_DB_ERROR) returned when
+	// connecting to a database which does not exist.
+	errBadDB = 1049
+	// errUnknownSystemVariable is the MySQL error number (ER_UNKNOWN_SYSTEM_VARIABLE)
+	// returned when querying a variable the server does not have.
+	errUnknownSystemVariable = 1193
+	// errServerOfflineMode is the MySQL error number (ER_SERVER_OFFLINE_MODE) returned
+	// when a user without CONNECTION_ADMIN connects to a server in offline_mode.
+	errServerOfflineMode = 3032
+	// errTableAccessDenied is the MySQL error number (ER_TABLEACCESS_DENIED_ERROR)
+	// returned when the user lacks a privilege on a table.
+	errTableAccessDenied = 1142
+	// errOptionPreventsStatement is the MySQL error number
+	// (ER_OPTION_PREVENTS_STATEMENT) returned when writing to a read-only server.
+	errOptionPreventsStatement = 1290
+	// errNoSuchTable is the MySQL error number (ER_NO_SUCH_TABLE) returned when
+	// querying a table which does not exist.
+	errNoSuchTable = 1146
+	// errWsrepNotReady is the MySQL error number (ER_UNKNOWN_COM_ERROR) returned
+	// by a wsrep node which is not ready to accept queries.
+	errWsrepNotReady = 1047
 )
 
+// NewDBHandler instantiates a new DBHandler like CreateDBHandler.  Since sql.Open
+// does not connect, the connection is only validated here if
+// options.validate_on_create is set, so embedders get immediate feedback on a
+// broken connection config.
+func NewDBHandler(config *viper.Viper, db *sql.DB) (*DBHandler, error) {
+	instance := CreateDBHandler(config, db)
+
+	for _, check := range instance.customCheckList() {
+		if placeholders := countPlaceholders(check.query); placeholders != len(check.args) {
+			return nil, fmt.Errorf("custom query %q has %d placeholders but %d argument values",
+				check.query, placeholders, len(check.args))
+		}
+	}
+
+	if config.GetBool("options.validate_on_create") {
+		ctx, cancel := instance.newCheckContext()
+		defer cancel()
+
+		if err := instance.validateConnection(ctx); err != nil {
+			return nil, fmt.Errorf("error validating database connection: %w", err)
+		}
+	}
+
+	return instance, nil
+}
+
 // CreateDBHandler instantiates a new DBHandler struct to hold the database connection and associated options.
 func CreateDBHandler(config *viper.Viper, db *sql.DB) *DBHandler {
 	instance := new(DBHandler)
 	instance.db = db
-	instance.availableWhenDonor = config.GetBool("options.available_when_donor")
+	instance.validationQuery = config.GetString("connection.validation_query")
+	instance.dbName = config.GetString("connection.dbname")
+	// The password is only kept to redact it from the errors reported to clients.
+	instance.password, _ = resolvePassword(config)
+	instance.disablePreparedStatements = config.GetBool("connection.disable_prepared_statements")
+	instance.availableStates = parseWsrepStates(config.GetStringSlice("options.available_states"))
+	// available_when_donor predates available_states and is kept as a shorthand.
+	if config.GetBool("options.available_when_donor") {
+		instance.availableStates[Donor] = true
+	}
 	instance.availableWhenReadOnly = config.GetBool("options.available_when_readonly")
+	instance.slowStartDuration = config.GetDuration("options.slow_start_duration")
+	instance.concurrentChecks = config.GetBool("options.concurrent_checks")
+	instance.successThreshold = config.GetInt("options.success_threshold")
+	instance.heartbeatTable = config.GetString("options.heartbeat.table")
+	instance.heartbeatColumn = config.GetString("options.heartbeat.column")
+	instance.heartbeatMaxLag = config.GetDuration("options.heartbeat.max_lag")
+	instance.maxReplicationLag = config.GetInt("options.max_replication_lag")
+	instance.checkMode = config.GetString("options.check_mode")
+	instance.scratchTable = config.GetString("options.read_write.table")
+	instance.readWriteTimeout = config.GetDuration("options.read_write.timeout")
+	instance.checkCloneStatus = config.GetBool("options.check_clone_status")
+	instance.detectEviction = config.GetBool("options.detect_eviction")
+	instance.detectDiskFull = config.GetBool("options.detect_disk_full")
+	instance.requireBinlog = config.GetBool("options.require_binlog")
+	instance.detectSST = config.GetBool("options.detect_sst")
+	instance.checkTimeout = config.GetDuration("options.check_timeout")
+	instance.retryAttempts = config.GetInt("options.retry_attempts")
+	instance.retryDelay = config.GetDuration("options.retry_delay")
+	instance.cacheTTL = config.GetDuration("options.cache_ttl")
+	instance.honorOfflineMode = config.GetBool("options.honor_offline_mode")
+	instance.clusterMinSize = config.GetInt("options.cluster_min_size")
+	instance.requireQuorum = config.GetBool("options.require_quorum")
+	instance.requirePrimaryComponent = config.GetBool("options.require_primary_component")
+	instance.latencies = NewLatencyWindow(config.GetInt("options.latency_window"))
+	instance.coldStartChecks = config.GetInt("options.exclude_coldstart_from_metrics")
+
+	// Handlers are created again on reload, which restarts the grace period.
+	if grace := config.GetDuration("options.startup_grace_period"); grace > 0 {
+		instance.startupGraceUntil = time.Now().Add(grace)
+	}
+	instance.preCheck = NewPreCheck(config)
+	instance.maintenanceFile = config.GetString("options.maintenance_file")
+	instance.resultWindow = NewResultWindow(config.GetInt("options.result_window"))
+	instance.certExpiry = NewCertExpiry(config)
+	instance.maxClockSkew = config.GetDuration("options.max_clock_skew")
+	instance.failOnClockSkew = config.GetBool("options.fail_on_clock_skew")
+	instance.commitProgressWindow = config.GetDuration("options.commit_progress_window")
+	instance.maxSeqnoGap = config.GetInt64("options.max_seqno_gap")
+	instance.circuitBreakerThreshold = config.GetInt("options.circuit_breaker_threshold")
+	instance.circuitBreakerCooldown = config.GetDuration("options.circuit_breaker_cooldown")
+
+	instance.clusterMode = config.GetString("options.cluster_mode")
+
+	switch instance.clusterMode {
+	case clusterModeGalera, clusterModeGroupReplication, clusterModeStandalone:
+	default:
+		logrus.Errorf("Unknown options.cluster_mode %q, using %q", instance.clusterMode, clusterModeGalera)
+		instance.clusterMode = clusterModeGalera
+	}
 
-	if config.IsSet("customQuery") && config.IsSet("customResult") {
-		customQuery = config.GetString("customQuery")
-		customResult = config.GetString("customResult")
-		logrus.Info("Custom query and result configured")
+	switch instance.checkMode {
+	case checkModeDefault, checkModeReadWrite, checkModePrimaryOnly:
+	default:
+		logrus.Errorf("Unknown options.check_mode %q, using %q", instance.checkMode, checkModeDefault)
+		instance.checkMode = checkModeDefault
+	}
+
+	switch role := config.GetString("options.role"); role {
+	case "", rolePrimary:
+	case roleStandby:
+		logrus.Info("Node is configured as a standby.")
+		instance.standby = true
+	default:
+		logrus.Errorf("Unknown options.role %q, using %q", role, rolePrimary)
+	}
+
+	if config.IsSet("options.checks") {
+		instance.customChecks = readCustomChecks(config)
+
+		if config.IsSet("customQuery") {
+			logrus.Warn("customQuery is ignored since options.checks is set")
+		}
+	} else if config.IsSet("customQuery") && config.IsSet("customResult") {
+		instance.customQuery = config.GetString("customQuery")
+		instance.customResult = strings.TrimSpace(config.GetString("customResult"))
+
+		for _, arg := range config.GetStringSlice("customQueryArgs") {
+			instance.customQueryArgs = append(instance.customQueryArgs, arg)
+		}
+
+		if instance.customResult != config.GetString("customResult") {
+			logrus.Warn("Leading and trailing whitespace was removed from customResult")
+		}
+
+		if instance.customResult == "" {
+			logrus.Warn("customResult is empty, any row returned by customQuery counts as healthy")
+		}
+	}
+
+	if instance.runsCustomQuery() {
+		instance.customResultRowMode = config.GetString("customResultRowMode")
+		instance.customResultMaxLength = config.GetInt("customResultMaxLength")
+		instance.customQueryTimeout = config.GetDuration("options.custom_query_timeout")
+
+		switch instance.customResultRowMode {
+		case rowModeFirstRow, rowModeAllMatch, rowModeAnyMatch:
+		default:
+			logrus.Errorf("Unknown customResultRowMode %q, using %q", instance.customResultRowMode, rowModeFirstRow)
+			instance.customResultRowMode = rowModeFirstRow
+		}
+
+		logrus.Info("Custom query and result configured.")
 	} else {
-		logrus.Info("Custom query or result is empty")
+		logrus.Info("Custom query or result is empty.")
 	}
 
-	instance.db.SetMaxOpenConns(databaseMaxOpenConns)
-	instance.db.SetConnMaxLifetime(databaseConnMaxLifetime)
+	instance.db.SetMaxOpenConns(config.GetInt("connection.pool.max_open_conns"))
+	instance.db.SetMaxIdleConns(config.GetInt("connection.pool.max_idle_conns"))
+	instance.db.SetConnMaxLifetime(config.GetDuration("connection.pool.conn_max_lifetime"))
+	// Idle connections are recycled before load balancers silently drop them.
+	instance.db.SetConnMaxIdleTime(config.GetDuration("connection.pool.conn_max_idle_time"))
+
+	if instance.certExpiry != nil {
+		instance.certExpiry.Check()
+	}
 
 	return instance
 }
 
-// BuildDSN constructs a MySQL DSN from the provided connection config.
-func BuildDSN(config *viper.Viper) string {
+// UseSingleConnection limits the connection pool to a single connection which is
+// kept for the lifetime of the DBHandler, for standalone checks which exit once
+// done and have no use for a pool.  Every query of a check reuses the connection
+// opened by the first one.
+func (h *DBHandler) UseSingleConnection() {
+	h.db.SetMaxOpenConns(1)
+	h.db.SetMaxIdleConns(1)
+	h.db.SetConnMaxLifetime(0)
+	h.db.SetConnMaxIdleTime(0)
+}
+
+// BuildDSN constructs a MySQL DSN from the provided connection config.  It fails if
+// the password file, the time zone or, unless a TLS config was loaded before, the
+// TLS files cannot be loaded.
+func BuildDSN(config *viper.Viper) (string, error) {
 	dsnConfig := mysql.NewConfig()
 	dsnConfig.Params = make(map[string]string)
 
@@ -104,78 +634,313 @@ func BuildDSN(config *viper.Viper) string {
 		dsnConfig.User = config.GetString("connection.user")
 	}
 
-	if config.IsSet("connection.password") {
-		dsnConfig.Passwd = config.GetString("connection.password")
+	password, err := resolvePassword(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to read connection password: %w", err)
+	}
+
+	dsnConfig.Passwd = password
+
+	if config.IsSet("connection.dbname") {
+		dsnConfig.DBName = config.GetString("connection.dbname")
 	}
 
-	if config.GetBool("connection.tls.required") {
+	tlsEnabled := config.GetBool("connection.tls.required") || config.IsSet("connection.tls.ca") ||
+		config.GetBool("connection.tls.skip-verify")
+
+	switch {
+	case config.IsSet("connection.tls.ca") || (tlsEnabled && config.GetBool("connection.tls.session_resumption")):
+		// Full TLS is enabled with custom CA or session cache
+		if err := loadTLSConfig(config); err != nil {
+			return "", err
+		}
+
+		dsnConfig.TLSConfig = customTLSConfigName
+	case config.GetBool("connection.tls.skip-verify"):
+		// Enable SSL but skip TLS verification
+		dsnConfig.TLSConfig = "skip-verify"
+	case config.GetBool("connection.tls.required"):
 		// Full TLS is enabled
 		dsnConfig.TLSConfig = "true"
 	}
 
-	if config.IsSet("connection.tls.ca") {
-		// Full TLS is enabled with custom CA
-		tlsConfig := buildTLSConfig(config)
-		err := mysql.RegisterTLSConfig("custom", tlsConfig)
-		if err != nil {
-			logrus.Fatalf("Failed to register custom TLS configuration: %v", err)
+	if config.IsSet("connection.attributes") {
+		attributes := buildConnectionAttributes(config.GetStringMapString("connection.attributes"))
+		if attributes != "" {
+			// Config.FormatDSN does not encode ConnectionAttributes, so pass them as a parameter.
+			dsnConfig.Params["connectionAttributes"] = attributes
 		}
-		dsnConfig.TLSConfig = "custom"
 	}
 
-	if config.GetBool("connection.tls.skip-verify") {
-		// Enable SSL but skip TLS verification
-		dsnConfig.TLSConfig = "skip-verify"
+	dsnConfig.ParseTime = config.GetBool("connection.parse_time")
+	// Interpolation substitutes customQueryArgs client-side, instead of preparing
+	// customQuery on the server for every check.
+	dsnConfig.InterpolateParams = config.GetBool("connection.interpolate_params")
+
+	if config.IsSet("connection.loc") {
+		loc, err := time.LoadLocation(config.GetString("connection.loc"))
+		if err != nil {
+			return "", fmt.Errorf("failed to load connection time zone: %w", err)
+		}
+
+		dsnConfig.Loc = loc
 	}
 
 	dsnConfig.Timeout = time.Second
 
+	if config.IsSet("connection.params") {
+		dsnConfig, err = applyDSNParams(dsnConfig, config.GetStringMapString("connection.params"))
+		if err != nil {
+			return "", err
+		}
+	}
+
 	if logrus.IsLevelEnabled(logrus.DebugLevel) {
 		sanitizedDsn := dsnConfig.Clone()
 		sanitizedDsn.Passwd = "<redacted>"
 		logrus.Debug(fmt.Sprintf("Constructed DSN for MySQL: %s", sanitizedDsn.FormatDSN()))
 	}
 
-	return dsnConfig.FormatDSN()
+	return dsnConfig.FormatDSN(), nil
+}
+
+// BuildPortDSN constructs a MySQL DSN like BuildDSN, but connecting over TCP to
+// port of connection.host, for the additional instances in connection.ports.
+func BuildPortDSN(config *viper.Viper, port int) (string, error) {
+	dsn, err := BuildDSN(config)
+	if err != nil {
+		return "", err
+	}
+
+	dsnConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse DSN: %w", err)
+	}
+
+	dsnConfig.Net = "tcp"
+	dsnConfig.Addr = net.JoinHostPort(config.GetString("connection.host"), strconv.Itoa(port))
+
+	return dsnConfig.FormatDSN(), nil
+}
+
+// applyDSNParams returns dsnConfig with params added as DSN parameters, after the
+// built-in ones so they can be overridden, e.g. timeout.  Parameters set from other
+// config keys are skipped with a warning.  The parameters are parsed by the driver,
+// so driver parameters are validated and set on the config like in any DSN.
+func applyDSNParams(dsnConfig *mysql.Config, params map[string]string) (*mysql.Config, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	query := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		name := key
+		if driverName, ok := driverParams[strings.ToLower(key)]; ok {
+			name = driverName
+		}
+
+		if configKey, ok := managedParams[name]; ok {
+			logrus.Warnf("Skipping connection param %q: it is set by %s", name, configKey)
+			continue
+		}
+
+		query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(params[key]))
+	}
+
+	if len(query) == 0 {
+		return dsnConfig, nil
+	}
+
+	// The password may hold a '?', so only look for parameters after the last '/'.
+	dsn := dsnConfig.FormatDSN()
+	if strings.Contains(dsn[strings.LastIndex(dsn, "/"):], "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+
+	parsed, err := mysql.ParseDSN(dsn + strings.Join(query, "&"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection.params: %w", err)
+	}
+
+	return parsed, nil
+}
+
+// resolvePassword returns the password of the configured user.  A literal
+// connection.password takes precedence over connection.password_file, whose
+// trailing newlines are trimmed, and a connection.password of the form ${VAR}
+// is only expanded from the environment if no password file is set.
+func resolvePassword(config *viper.Viper) (string, error) {
+	password := config.GetString("connection.password")
+	envVar, hasPrefix := strings.CutPrefix(password, "${")
+	envVar, hasSuffix := strings.CutSuffix(envVar, "}")
+	isEnvVar := hasPrefix && hasSuffix
+
+	switch {
+	case password != "" && !isEnvVar:
+		return password, nil
+	case config.IsSet("connection.password_file"):
+		data, err := os.ReadFile(config.GetString("connection.password_file"))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case isEnvVar:
+		return os.Getenv(envVar), nil
+	}
+
+	return password, nil
+}
+
+// buildConnectionAttributes encodes the configured connection attributes in the
+// driver's "key:value,key:value" format.  Attributes which MySQL would truncate
+// or which cannot be encoded are skipped with a warning.
+func buildConnectionAttributes(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		value := attributes[key]
+
+		switch {
+		case key == "" || strings.ContainsAny(key, ":,"):
+			logrus.Warnf("Skipping connection attribute %q: keys must be non-empty and not contain ':' or ','", key)
+		case strings.HasPrefix(key, "_"):
+			logrus.Warnf("Skipping connection attribute %q: keys beginning with '_' are reserved", key)
+		case len(key) > maxConnAttrKeyLength:
+			logrus.Warnf("Skipping connection attribute %q: keys must not exceed %d bytes", key, maxConnAttrKeyLength)
+		case strings.Contains(value, ","):
+			logrus.Warnf("Skipping connection attribute %q: values must not contain ','", key)
+		case len(value) > maxConnAttrValueLength:
+			logrus.Warnf("Skipping connection attribute %q: values must not exceed %d bytes", key, maxConnAttrValueLength)
+		default:
+			pairs = append(pairs, key+":"+value)
+		}
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// loadTLSConfig builds the TLS config of connection.tls and registers it with the
+// MySQL driver under customTLSConfigName.  Since BuildDSN runs again on every
+// SIGHUP reload, re-registering under the same name replaces the previous config,
+// so a rotated CA is honored by the new connection pool without a restart.  If
+// the TLS files cannot be loaded, for example while the CA file is being
+// replaced, the previously registered config is kept rather than falling back to
+// the system CAs, and an error is only returned if none was registered yet.
+func loadTLSConfig(config *viper.Viper) error {
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		if customTLSRegistered {
+			logrus.Warnf("Keeping the previously loaded TLS configuration: %v", err)
+			return nil
+		}
+
+		return fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+
+	if err := mysql.RegisterTLSConfig(customTLSConfigName, tlsConfig); err != nil {
+		return fmt.Errorf("failed to register custom TLS configuration: %w", err)
+	}
+
+	customTLSRegistered = true
+
+	return nil
 }
 
 // buildTLSConfig creates a tls.Config instance from the provided application TLS config.
-func buildTLSConfig(config *viper.Viper) *tls.Config {
+// Unless connection.tls.session_resumption is disabled, TLS sessions are cached so
+// reconnections to the database server skip the full handshake.
+func buildTLSConfig(config *viper.Viper) (*tls.Config, error) {
 	var tlsConfig tls.Config
 
+	tlsConfig.InsecureSkipVerify = config.GetBool("connection.tls.skip-verify") //nolint:gosec // Explicitly requested
+
+	if config.GetBool("connection.tls.session_resumption") {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(tlsSessionCacheSize)
+	}
+
 	rootCertPool := x509.NewCertPool()
 
 	if config.IsSet("connection.tls.ca") {
 		pem, err := os.ReadFile(config.GetString("connection.tls.ca"))
 		if err != nil {
-			logrus.Error(err)
+			return nil, err
 		}
 
 		if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
-			logrus.Error("Failed to append PEM.")
-		} else {
-			tlsConfig.RootCAs = rootCertPool
+			return nil, fmt.Errorf("no PEM certificate found in %s", config.GetString("connection.tls.ca"))
 		}
+
+		tlsConfig.RootCAs = rootCertPool
 	}
 
 	if config.IsSet("connection.tls.cert") && config.IsSet("connection.tls.key") {
 		certs, err := tls.LoadX509KeyPair(config.GetString("connection.tls.cert"),
 			config.GetString("connection.tls.key"))
 		if err != nil {
-			logrus.Error(err)
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certs}
+	}
+
+	return &tlsConfig, nil
+}
+
+// readCustomChecks reads the list of custom checks of options.checks, skipping
+// entries without a query.
+func readCustomChecks(config *viper.Viper) []customCheck {
+	var entries []struct {
+		Query          string   `mapstructure:"query"`
+		ExpectedResult string   `mapstructure:"expected_result"`
+		Args           []string `mapstructure:"args"`
+	}
+
+	if err := config.UnmarshalKey("options.checks", &entries); err != nil {
+		logrus.Errorf("Invalid options.checks, ignoring it: %v", err)
+		return nil
+	}
+
+	var checks []customCheck
+
+	for i, entry := range entries {
+		if strings.TrimSpace(entry.Query) == "" {
+			logrus.Errorf("Entry %d of options.checks has no query, ignoring it", i+1)
+			continue
 		}
 
-		clientCert := make([]tls.Certificate, 0, 1)
-		clientCert = append(clientCert, certs)
+		check := customCheck{query: entry.Query, expectedResult: strings.TrimSpace(entry.ExpectedResult)}
+		for _, arg := range entry.Args {
+			check.args = append(check.args, arg)
+		}
 
-		tlsConfig.Certificates = clientCert
+		checks = append(checks, check)
 	}
 
-	return &tlsConfig
+	return checks
 }
 
+// isConnected validates the connection to the database server, either with a
+// ping or, if connection.validation_query is set, by running that query so the
+// check reaches the backend through any intermediate proxy.
 func (h *DBHandler) isConnected() bool {
-	if err := h.db.Ping(); err != nil {
+	ctx, cancel := h.newCheckContext()
+	defer cancel()
+
+	if err := h.retry(ctx, func() error { return h.validateConnection(ctx) }); err != nil {
 		logrus.Error(err)
 		return false
 	}
@@ -183,153 +948,1756 @@ func (h *DBHandler) isConnected() bool {
 	return true
 }
 
-// GetStatus performs a health check on the database server and returns an int type
-// enumerating the specific state.
-func (h *DBHandler) GetStatus() ServerStatus {
-	if h.isConnected() {
-		if customQuery != "" {
-			result := h.getCustomRequest(customQuery)
-			return result
-		} else {
-			logrus.Info("Executing normal queyr")
-			wsrepState := h.getWsrepLocalState()
-			if wsrepState == Synced || (wsrepState == Donor && h.availableWhenDonor) {
-				if !h.availableWhenReadOnly && h.isReadOnly() {
-					return ReadOnly
-				}
+// validateConnection pings the database server, or runs the validation query if
+// one is configured, and returns any resulting error.
+func (h *DBHandler) validateConnection(ctx context.Context) error {
+	if h.validationQuery == "" {
+		return h.db.PingContext(ctx)
+	}
 
-				return Available
-			}
+	rows, err := h.db.QueryContext(ctx, h.validationQuery)
+	if err != nil {
+		return err
+	}
 
-			return NotReady
+	return rows.Close()
+}
+
+// retry runs fn until it succeeds, fails with an error which is not transient, or
+// has run options.retry_attempts times, waiting options.retry_delay in between.
+// Waiting stops as soon as ctx is done, so retries never outlast the check timeout.
+func (h *DBHandler) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= h.retryAttempts || !isTransientError(err) {
+			return err
+		}
+
+		logrus.Debugf("Attempt %d of %d failed, retrying in %s: %v", attempt, h.retryAttempts, h.retryDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(h.retryDelay):
 		}
 	}
+}
+
+// isTransientError reports whether err is a network or dropped connection error,
+// which a new attempt may not run into.  Errors returned by the server itself, as
+// well as expired contexts, are not transient.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+
+	var netErr net.Error
 
-	return Unavailable
+	return errors.As(err, &netErr)
 }
 
-// getWsrepLocalState queries the wsrep_local_state status from the database
-// server and returns an int type enumerating the specific state.
-func (h *DBHandler) getWsrepLocalState() WsrepStatus {
-	stmtOut, err := h.db.Prepare(wsrepLocalStateQuery)
-	if err != nil {
-		logrus.Errorf("Error preparing wsrep_local_state query: %v", err)
-		return Joining
+// newCheckContext returns the context of a health check, which is cancelled after
+// options.check_timeout if set, so a hung server cannot hold a check for as long
+// as the driver's own timeouts.
+func (h *DBHandler) newCheckContext() (context.Context, context.CancelFunc) {
+	if h.checkTimeout <= 0 {
+		return context.WithCancel(context.Background())
 	}
 
-	defer func() {
-		if err := stmtOut.Close(); err != nil {
-			logrus.Errorf("Error closing prepared statement: %v", err)
-		}
-	}()
+	return context.WithTimeout(context.Background(), h.checkTimeout)
+}
 
-	var variable string
+// recordError keeps a sanitized copy of err as the last database error.  Only the
+// error number and a truncated message are kept, with the password redacted.
+func (h *DBHandler) recordError(err error) {
+	lastError := &LastError{Message: err.Error(), Time: time.Now().UTC()}
 
-	var value int
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		lastError.Number = mysqlErr.Number
+		lastError.Message = mysqlErr.Message
+	}
 
-	err = stmtOut.QueryRow().Scan(&variable, &value)
-	if err != nil {
-		logrus.Errorf("Error executing wsrep_local_state query: %v", err)
-		return Joining
+	if h.password != "" {
+		lastError.Message = strings.ReplaceAll(lastError.Message, h.password, "<redacted>")
 	}
 
-	return WsrepStatus(value)
+	if len(lastError.Message) > maxLastErrorLength {
+		lastError.Message = lastError.Message[:maxLastErrorLength] + "..."
+	}
+
+	h.mu.Lock()
+	h.lastError = lastError
+	h.mu.Unlock()
 }
 
-func (h *DBHandler) getCustomRequest(query string) ServerStatus {
+// LastError returns the last database error met by a health check, or nil if none was.
+func (h *DBHandler) LastError() *LastError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	logrus.Debugf("Executing custom query: %s", query)
+	return h.lastError
+}
 
-	/*result, err := h.db.Exec(query)
+// WsrepState returns the wsrep_local_state most recently read from the database
+// server, and whether the last attempt to read it succeeded.
+func (h *DBHandler) WsrepState() (WsrepStatus, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	if err != nil {
-		logrus.Errorf("Error executing CUSTOM query: %v", err)
-		return Unavailable
+	return h.wsrepState, h.wsrepStateKnown
+}
+
+// recordCustomQueryDuration keeps the duration of the last run of customQuery,
+// including reading its result.
+func (h *DBHandler) recordCustomQueryDuration(duration time.Duration) {
+	logrus.Debugf("Custom query took %s.", duration)
+
+	h.mu.Lock()
+	h.customQueryDuration, h.customQueryRun = duration, true
+	h.mu.Unlock()
+}
+
+// CustomQueryDuration returns the duration of the last run of customQuery, if it
+// ran at all.
+func (h *DBHandler) CustomQueryDuration() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.customQueryDuration, h.customQueryRun
+}
+
+// CertExpiry returns the expiry of the TLS client certificate, or nil if it is not tracked.
+func (h *DBHandler) CertExpiry() *CertExpiry {
+	return h.certExpiry
+}
+
+// Latencies returns the durations of recent health checks, or nil if they are not tracked.
+func (h *DBHandler) Latencies() *LatencyWindow {
+	return h.latencies
+}
+
+// countCheck counts a health check run, and returns whether it is one of the
+// first options.exclude_coldstart_from_metrics checks, which include the setup of
+// the first connections.
+func (h *DBHandler) countCheck() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.checksRun <= h.coldStartChecks {
+		h.checksRun++
 	}
 
-	logrus.Infof("Result OK : %v", result)*/
+	return h.checksRun <= h.coldStartChecks
+}
 
-	/* else {
-		var index, rows int64
-		index, err = result.LastInsertId()
-		logrus.Infof("Index : %d, err : %v", index, err)
-		rows, err = result.RowsAffected()
-		logrus.Infof("Rows : %d, err : %v", rows, err)
+// SetStartupGrace makes the handler report a failure to reach the database server
+// as the database still starting, rather than as an error, until the given time.
+// The grace period of options.startup_grace_period, which runs from the creation
+// of the handler, is kept if it ends later.
+func (h *DBHandler) SetStartupGrace(until time.Time) {
+	if until.After(h.startupGraceUntil) {
+		h.startupGraceUntil = until
 	}
+}
 
-	//var value int64
+// GetStatus performs a health check on the database server and returns the
+// resulting state, along with the specific reason for it when one is known.  With
+// options.cache_ttl, the result of a previous check is returned instead while it
+// is newer than the TTL, so frequent probes from several balancers cost a single
+// check.  Concurrent calls then wait for the check in progress rather than
+// running their own.  While options.maintenance_file exists, the node is reported
+// unavailable without querying the database server.
+func (h *DBHandler) GetStatus() CheckResult {
+	result, _ := h.getStatus()
+
+	return result
+}
 
-	var _, err2 = h.db.Query(customQuery)
-	if err2 != nil {
-		logrus.Errorf("Error2 executing CUSTOM query: %v", err2)
-		return Unavailable
-	} /*else {
-		var index, rows int64
-		index, err = result.LastInsertId()
-		logrus.Infof("Index : %d, err : %v", rows2, err2)
-		rows, err = result.RowsAffected()
-		logrus.Infof("Rows : %d, err : %v", rows, err2)
-	}*/
+// getStatus returns the result of GetStatus, along with whether it was found by a
+// cold-start check run for this call, as per options.exclude_coldstart_from_metrics.
+// Cached and maintenance results never are.
+func (h *DBHandler) getStatus() (CheckResult, bool) {
+	if h.inMaintenance() {
+		return CheckResult{Status: Unavailable, Reason: ReasonMaintenance}, false
+	}
 
-	/*value, err = result.
-	if err != nil {
-		logrus.Errorf("Error getting Affected rows: %v", err)
-		return Unavailable
-	}*/
+	if h.cacheTTL <= 0 {
+		return h.runStatusCheck()
+	}
 
-	var queryResult string
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
 
-	var result, err2 = h.db.Query(query)
-	if err2 != nil {
-		logrus.Errorf("Error2 executing CUSTOM query: %v", err2)
-		return NotReady
+	if !h.cachedAt.IsZero() && time.Since(h.cachedAt) < h.cacheTTL {
+		return h.cachedResult, false
 	}
 
-	if result.Next() {
-		result.Scan(&queryResult)
+	result, coldStart := h.runStatusCheck()
+	h.cachedResult = result
+	h.cachedAt = time.Now()
 
-		if queryResult == customResult {
-			result.Close()
-			return Available
-		}
-	} else {
-		logrus.Errorf("No query result")
-		result.Close()
-		return NotReady
+	return result, coldStart
+}
+
+// inMaintenance reports whether options.maintenance_file exists.  It is looked up
+// on every check, so operators can drain the node and bring it back without a
+// restart.
+func (h *DBHandler) inMaintenance() bool {
+	if h.maintenanceFile == "" {
+		return false
 	}
-	result.Close()
 
-	logrus.Errorf("Result is incorrect : '%s' != '%s'", queryResult, customResult)
+	_, err := os.Stat(h.maintenanceFile)
+
+	switch {
+	case err == nil:
+		logrus.Debugf("Maintenance file %s is present.", h.maintenanceFile)
+		return true
+	case !errors.Is(err, os.ErrNotExist):
+		logrus.Errorf("Error checking maintenance file: %v", err)
+	}
 
-	return NotReady
+	return false
 }
 
-// isReadOnly queries the global variable read_only from the database server
-// and returns whether the server is in read-only mode.
-func (h *DBHandler) isReadOnly() bool {
-	stmtOut, err := h.db.Prepare(readOnlyQuery)
-	if err != nil {
-		logrus.Errorf("Error preparing read_only query: %v", err)
+// runStatusCheck performs a health check through the circuit breaker, result
+// window and success threshold, and returns its result along with whether it was
+// a cold-start check.
+func (h *DBHandler) runStatusCheck() (CheckResult, bool) {
+	coldStart := h.countCheck()
+	if coldStart {
+		logrus.Debug("Excluding cold-start health check from the check latency window.")
+	} else if h.latencies != nil {
+		defer func(start time.Time) { h.latencies.Observe(time.Since(start)) }(time.Now())
 	}
 
-	defer func() {
-		if err := stmtOut.Close(); err != nil {
-			logrus.Errorf("Error closing prepared statement: %v", err)
-		}
-	}()
+	if h.certExpiry != nil {
+		h.certExpiry.Check()
+	}
 
-	var variable string
+	result := h.checkCircuitBreaker()
 
-	var value string
+	if h.resultWindow != nil {
+		result = h.resultWindow.Apply(result)
+	}
 
-	err = stmtOut.QueryRow().Scan(&variable, &value)
-	if err != nil {
-		logrus.Errorf("Error executing read_only query: %v", err)
+	result = h.applySuccessThreshold(result)
+	result = h.applyRole(result)
+	h.trackAvailability(result.Status)
+
+	return result, coldStart
+}
+
+// checkCircuitBreaker runs the health check unless options.circuit_breaker_threshold
+// consecutive checks found the node unavailable, in which case the database server
+// is left alone and the node reported unavailable until options.circuit_breaker_cooldown
+// has passed.  A single failed check after the cooldown opens the circuit again.
+func (h *DBHandler) checkCircuitBreaker() CheckResult {
+	if h.circuitBreakerThreshold <= 0 {
+		return h.checkStatus(false)
 	}
 
-	if value == "OFF" {
-		return false
+	h.mu.Lock()
+	open := time.Now().Before(h.circuitOpenUntil)
+	h.mu.Unlock()
+
+	if open {
+		return CheckResult{Status: Unavailable, Reason: ReasonCircuitOpen}
 	}
 
-	return true
+	result := h.checkStatus(false)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if result.Status != Unavailable {
+		h.unavailableStreak = 0
+		return result
+	}
+
+	h.unavailableStreak++
+
+	if h.unavailableStreak >= h.circuitBreakerThreshold {
+		logrus.Warnf("Node was unavailable for %d consecutive checks, skipping checks for %s.",
+			h.unavailableStreak, h.circuitBreakerCooldown)
+
+		h.circuitOpenUntil = time.Now().Add(h.circuitBreakerCooldown)
+	}
+
+	return result
+}
+
+// GetStrictStatus runs a health check like GetStatus, but disregarding the
+// options which tolerate nodes that are not fully synced and writable:
+// options.available_states, options.available_when_donor and
+// options.available_when_readonly.  It is meant for one-off probes, so its result
+// does not go through the circuit breaker, result window or success threshold,
+// nor affect them.
+func (h *DBHandler) GetStrictStatus() CheckResult {
+	if h.inMaintenance() {
+		return CheckResult{Status: Unavailable, Reason: ReasonMaintenance}
+	}
+
+	return h.applyRole(h.checkStatus(true))
+}
+
+// applyRole reports an available node as Standby if options.role is standby.
+// Nodes which are not healthy are reported as they are, so a failing standby is
+// not kept as a backup target.
+func (h *DBHandler) applyRole(result CheckResult) CheckResult {
+	if h.standby && result.Status == Available {
+		return CheckResult{Status: Standby}
+	}
+
+	return result
+}
+
+// applySuccessThreshold holds back an Available result until the node has passed
+// options.success_threshold consecutive checks, so a recovering node does not
+// flap to available on a single lucky check.
+func (h *DBHandler) applySuccessThreshold(result CheckResult) CheckResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if result.Status != Available {
+		h.successStreak = 0
+		return result
+	}
+
+	if h.successStreak < h.successThreshold {
+		h.successStreak++
+	}
+
+	if h.successStreak < h.successThreshold {
+		logrus.Debugf("Node passed %d of %d consecutive checks required to be available.",
+			h.successStreak, h.successThreshold)
+
+		return CheckResult{Status: NotReady, Reason: ReasonRecovering}
+	}
+
+	return result
+}
+
+// Weight returns the routing weight (0-100) for a node in the given state.  When
+// options.slow_start_duration is set, a node that has recently become available
+// ramps linearly from minWeight up to maxWeight over that duration.
+func (h *DBHandler) Weight(status ServerStatus) int {
+	if status != Available {
+		return 0
+	}
+
+	if h.slowStartDuration <= 0 {
+		return maxWeight
+	}
+
+	h.mu.Lock()
+	elapsed := time.Since(h.availableSince)
+	h.mu.Unlock()
+
+	if elapsed >= h.slowStartDuration {
+		return maxWeight
+	}
+
+	ramp := float64(elapsed) / float64(h.slowStartDuration)
+
+	return minWeight + int(ramp*float64(maxWeight-minWeight))
+}
+
+// trackAvailability records when the node became available.  A node found to be
+// available on the very first check is considered warm, since we cannot know
+// how long it has been serving before we started.
+func (h *DBHandler) trackAvailability(status ServerStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case status != Available:
+		h.availableSince = time.Time{}
+	case !h.checked:
+		h.availableSince = time.Now().Add(-h.slowStartDuration)
+	case h.availableSince.IsZero():
+		logrus.Debug("Node became available.")
+		h.availableSince = time.Now()
+	}
+
+	h.checked = true
+}
+
+// checkStatus runs the health check queries against the database server.  A
+// strict check disregards the options tolerating nodes which are not fully synced
+// and writable.
+func (h *DBHandler) checkStatus(strict bool) CheckResult {
+	if h.preCheck != nil {
+		if err := h.preCheck.Run(); err != nil {
+			logrus.Warnf("Pre-check failed: %v", err)
+			return CheckResult{Status: NotReady, Reason: ReasonPreCheckFailed}
+		}
+	}
+
+	ctx, cancel := h.newCheckContext()
+	defer cancel()
+
+	if err := h.retry(ctx, func() error { return h.validateConnection(ctx) }); err != nil {
+		// Errors from the server itself, such as failed authentication, show that it
+		// is up, so only failures to reach it are covered by the startup grace.
+		var mysqlErr *mysql.MySQLError
+		serverAnswered := errors.As(err, &mysqlErr)
+
+		if !serverAnswered && time.Now().Before(h.startupGraceUntil) {
+			logrus.Debugf("Database is not accepting connections yet: %v", err)
+			return CheckResult{Status: NotReady, Reason: ReasonStarting}
+		}
+
+		logrus.Error(err)
+		h.recordError(err)
+
+		if serverAnswered {
+			switch mysqlErr.Number {
+			case errAccessDenied:
+				return CheckResult{Status: Unavailable, Reason: ReasonAuth}
+			case errBadDB:
+				// The server is up, but the schema of the application was not created.
+				return CheckResult{Status: NotReady, Reason: ReasonDatabaseMissing}
+			case errServerOfflineMode:
+				if h.honorOfflineMode {
+					return CheckResult{Status: NotReady, Reason: ReasonOfflineMode}
+				}
+			}
+		}
+
+		return CheckResult{Status: Unavailable}
+	}
+
+	if h.dbName != "" {
+		if result, ok := h.checkDatabase(ctx); !ok {
+			return result
+		}
+	}
+
+	if h.honorOfflineMode {
+		if result, ok := h.checkOfflineMode(ctx); !ok {
+			return result
+		}
+	}
+
+	if h.checkCloneStatus {
+		if result, ok := h.checkClone(ctx); !ok {
+			return result
+		}
+	}
+
+	if h.detectEviction {
+		if result, ok := h.checkEviction(ctx); !ok {
+			return result
+		}
+	}
+
+	if h.checkTimedOut(ctx) {
+		return CheckResult{Status: Unavailable}
+	}
+
+	var result CheckResult
+
+	switch {
+	case h.runsCustomQuery():
+		result = h.getCustomRequest(ctx)
+	case h.clusterMode == clusterModeGroupReplication:
+		result = h.checkGroupReplication(ctx, strict)
+	case h.clusterMode == clusterModeStandalone:
+		result = h.checkStandalone(ctx, strict)
+	default:
+		result = h.checkWsrep(ctx, strict)
+	}
+
+	if h.checkTimedOut(ctx) {
+		return CheckResult{Status: Unavailable}
+	}
+
+	if h.detectSST && h.checksWsrep() && result.Status == NotReady && result.Reason == "" {
+		result = h.checkSST(ctx, result)
+	}
+
+	if h.requirePrimaryComponent && h.checksWsrep() && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkPrimaryComponent(ctx, result)
+	}
+
+	if h.detectDiskFull && result.Status == ReadOnly {
+		result = h.checkDiskFull(ctx, result)
+	}
+
+	if h.requireBinlog && result.Status == Available {
+		result = h.checkBinlog(ctx, result)
+	}
+
+	if h.requireQuorum && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkQuorum(ctx, result)
+	}
+
+	if h.maxClockSkew > 0 && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkClockSkew(ctx, result)
+	}
+
+	if h.commitProgressWindow > 0 && h.checksWsrep() && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkCommitProgress(ctx, result)
+	}
+
+	if h.maxReplicationLag > 0 && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkReplicationLag(ctx, result)
+	}
+
+	if h.maxSeqnoGap > 0 && h.checksWsrep() && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkSeqnoGap(ctx, result)
+	}
+
+	if h.heartbeatTable != "" && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkHeartbeat(ctx, result)
+	}
+
+	if h.checkMode == checkModeReadWrite && result.Status == Available {
+		result = h.checkReadWrite(ctx, result)
+	}
+
+	if h.checkMode == checkModePrimaryOnly && (result.Status == Available || result.Status == ReadOnly) {
+		result = h.checkPrimary(ctx, result)
+	}
+
+	if h.checkTimedOut(ctx) {
+		return CheckResult{Status: Unavailable}
+	}
+
+	return result
+}
+
+// checkTimedOut reports whether the health check ran past its timeout, which the
+// checks reading their queries' errors as inconclusive would otherwise leave
+// unnoticed.
+func (h *DBHandler) checkTimedOut(ctx context.Context) bool {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+
+	logrus.Errorf("Health check timed out after %s", h.checkTimeout)
+
+	return true
+}
+
+// checksWsrep reports whether the status of the node is determined by its wsrep
+// state, rather than by customQuery, its Group Replication member state or as a
+// standalone server.
+func (h *DBHandler) checksWsrep() bool {
+	return !h.runsCustomQuery() && h.clusterMode != clusterModeGroupReplication &&
+		h.clusterMode != clusterModeStandalone
+}
+
+// checkGroupReplication determines the status of the node from its Group
+// Replication member state and read-only mode.  An ONLINE member is treated like
+// a synced Galera node, and members in any other state, such as RECOVERING or
+// ERROR, are not ready.
+func (h *DBHandler) checkGroupReplication(ctx context.Context, strict bool) CheckResult {
+	memberState, err := h.getGroupReplicationState(ctx)
+	if err != nil {
+		logrus.Errorf("Error executing Group Replication member state query: %v", err)
+		h.recordError(err)
+
+		return CheckResult{Status: NotReady}
+	}
+
+	if memberState != groupMemberOnline {
+		logrus.Debugf("Group Replication member state is %s.", memberState)
+		return CheckResult{Status: NotReady}
+	}
+
+	if !h.toleratesReadOnly(strict) {
+		// Secondaries of a single-primary group are super_read_only.
+		if readOnly, _ := h.isReadOnly(ctx); readOnly {
+			return CheckResult{Status: ReadOnly}
+		}
+	}
+
+	return CheckResult{Status: Available}
+}
+
+// getGroupReplicationState returns the MEMBER_STATE of the local server in its
+// Group Replication group, which is OFFLINE if it is not part of any group.
+func (h *DBHandler) getGroupReplicationState(ctx context.Context) (string, error) {
+	var memberState string
+
+	err := h.queryRow(ctx, groupMemberStateQuery, &memberState)
+	if errors.Is(err, sql.ErrNoRows) {
+		return groupMemberOffline, nil
+	}
+
+	return memberState, err
+}
+
+// checkWsrep determines the status of the node from its wsrep state and read-only mode.
+func (h *DBHandler) checkWsrep(ctx context.Context, strict bool) CheckResult {
+	logrus.Debug("Executing wsrep status queries.")
+
+	if h.concurrentChecks && !h.toleratesReadOnly(strict) && h.db.Stats().MaxOpenConnections != 1 {
+		return h.checkWsrepConcurrently(ctx, strict)
+	}
+
+	wsrepState, err := h.getWsrepLocalState(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.checkStandalone(ctx, strict)
+	}
+
+	return h.evaluateWsrep(wsrepState, err, strict, func() (bool, error) {
+		return h.isReadOnly(ctx)
+	})
+}
+
+// checkStandalone checks a server which is not part of a cluster: it is available
+// if it answers SELECT 1, or read-only if read_only is set and not tolerated.
+func (h *DBHandler) checkStandalone(ctx context.Context, strict bool) CheckResult {
+	var one int
+
+	if err := h.queryRow(ctx, readProbeQuery, &one); err != nil {
+		logrus.Errorf("Error executing standalone check query: %v", err)
+		h.recordError(err)
+
+		return CheckResult{Status: NotReady}
+	}
+
+	if !h.toleratesReadOnly(strict) {
+		if readOnly, _ := h.isReadOnly(ctx); readOnly {
+			return CheckResult{Status: ReadOnly}
+		}
+	}
+
+	return CheckResult{Status: Available}
+}
+
+// checkWsrepConcurrently runs the wsrep_local_state and read_only queries at the
+// same time on separate pooled connections, so the check takes as long as the
+// slower query rather than both combined.  The read_only query is cancelled if
+// its result is not needed.
+func (h *DBHandler) checkWsrepConcurrently(ctx context.Context, strict bool) CheckResult {
+	type readOnlyResult struct {
+		readOnly bool
+		err      error
+	}
+
+	readOnlyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	readOnlyResults := make(chan readOnlyResult, 1)
+
+	go func() {
+		readOnly, err := h.isReadOnly(readOnlyCtx)
+		readOnlyResults <- readOnlyResult{readOnly, err}
+	}()
+
+	wsrepState, err := h.getWsrepLocalState(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		cancel()
+		<-readOnlyResults
+
+		return h.checkStandalone(ctx, strict)
+	}
+
+	return h.evaluateWsrep(wsrepState, err, strict, func() (bool, error) {
+		result := <-readOnlyResults
+		return result.readOnly, result.err
+	})
+}
+
+// evaluateWsrep combines the wsrep state of the node with its read-only mode,
+// which is only looked up via readOnly if the wsrep state allows the node to be
+// available.
+func (h *DBHandler) evaluateWsrep(wsrepState WsrepStatus, wsrepErr error, strict bool,
+	readOnly func() (bool, error)) CheckResult {
+	if isWsrepNotReady(wsrepErr) {
+		return CheckResult{Status: NotReady, Reason: ReasonWsrepNotReady}
+	}
+
+	if h.isAvailableState(wsrepState, strict) {
+		if !h.toleratesReadOnly(strict) {
+			readOnly, err := readOnly()
+			if isWsrepNotReady(err) {
+				return CheckResult{Status: NotReady, Reason: ReasonWsrepNotReady}
+			}
+
+			if readOnly {
+				return CheckResult{Status: ReadOnly}
+			}
+		}
+
+		return CheckResult{Status: Available}
+	}
+
+	return CheckResult{Status: NotReady}
+}
+
+// isAvailableState reports whether nodes in wsrepState are available, as per
+// options.available_states, or only if synced when no states are configured or
+// the check is strict.
+func (h *DBHandler) isAvailableState(wsrepState WsrepStatus, strict bool) bool {
+	if h.availableStates == nil || strict {
+		return wsrepState == Synced
+	}
+
+	return h.availableStates[wsrepState]
+}
+
+// toleratesReadOnly reports whether read-only nodes are available, as per
+// options.available_when_readonly, which strict checks disregard.
+func (h *DBHandler) toleratesReadOnly(strict bool) bool {
+	return h.availableWhenReadOnly && !strict
+}
+
+// wsrepStateNames maps the names accepted in options.available_states to their
+// wsrep_local_state.
+var wsrepStateNames = map[string]WsrepStatus{
+	"joining": Joining,
+	"donor":   Donor,
+	"joined":  Joined,
+	"synced":  Synced,
+}
+
+// parseWsrepStates returns the set of wsrep states with the given names, which
+// are case-insensitive.  Unknown names are logged and skipped, and the set falls
+// back to Synced if no name is valid, so a typo never makes every node unavailable.
+func parseWsrepStates(names []string) map[WsrepStatus]bool {
+	states := make(map[WsrepStatus]bool, len(names))
+
+	for _, name := range names {
+		state, ok := wsrepStateNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			logrus.Errorf("Unknown wsrep state %q in options.available_states, expected joining, donor, joined or synced",
+				name)
+			continue
+		}
+
+		states[state] = true
+	}
+
+	if len(states) == 0 {
+		logrus.Errorf("No valid wsrep state in options.available_states, using synced")
+		states[Synced] = true
+	}
+
+	return states
+}
+
+// isWsrepNotReady returns whether err is the error returned by a wsrep node
+// which is rejecting queries because it is not ready to serve them.
+func isWsrepNotReady(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errWsrepNotReady
+}
+
+// describeConnectionError explains why connecting to the database server failed
+// with err, telling authentication, DNS, TLS and network failures apart, followed
+// by the driver error.
+func describeConnectionError(err error) string {
+	var (
+		mysqlErr       *mysql.MySQLError
+		dnsErr         *net.DNSError
+		unknownAuthErr x509.UnknownAuthorityError
+		hostnameErr    x509.HostnameError
+		certInvalidErr x509.CertificateInvalidError
+		recordErr      tls.RecordHeaderError
+	)
+
+	var cause string
+
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errAccessDenied:
+		cause = "authentication failed, check connection.user and connection.password"
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errBadDB:
+		cause = "connection.dbname does not exist on the server"
+	case errors.As(err, &dnsErr):
+		cause = fmt.Sprintf("could not resolve %q, check connection.host", dnsErr.Name)
+	case errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &certInvalidErr):
+		cause = "the server certificate was rejected, check connection.tls"
+	case errors.As(err, &recordErr), errors.Is(err, mysql.ErrNoTLS):
+		cause = "TLS negotiation failed, check whether the server supports connection.tls"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		cause = "connection refused, check connection.host and connection.port"
+	case errors.Is(err, context.DeadlineExceeded), os.IsTimeout(err):
+		cause = "connection timed out, check connection.host and any firewall in between"
+	default:
+		return err.Error()
+	}
+
+	return fmt.Sprintf("%s (%v)", cause, err)
+}
+
+// getWsrepLocalState queries the wsrep_local_state status from the database
+// server and returns an int type enumerating the specific state.  Joining is
+// returned along with the error if the query fails.
+func (h *DBHandler) getWsrepLocalState(ctx context.Context) (WsrepStatus, error) {
+	var variable string
+
+	var value int
+
+	if err := h.queryRow(ctx, wsrepLocalStateQuery, &variable, &value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Servers without wsrep, such as a plain MySQL server, have no such status.
+			logrus.Debug("No wsrep_local_state available, checking the server as standalone.")
+		} else {
+			logrus.Errorf("Error executing wsrep_local_state query: %v", err)
+			h.recordError(err)
+		}
+
+		h.mu.Lock()
+		h.wsrepStateKnown = false
+		h.mu.Unlock()
+
+		return Joining, err
+	}
+
+	h.mu.Lock()
+	h.wsrepState, h.wsrepStateKnown = WsrepStatus(value), true
+	h.mu.Unlock()
+
+	return WsrepStatus(value), nil
+}
+
+// checkDatabase reports whether the configured connection.dbname exists.  Opening
+// a connection to a missing database fails, but pooled connections outlive a
+// dropped database, so the default database of the connection is checked too.
+func (h *DBHandler) checkDatabase(ctx context.Context) (CheckResult, bool) {
+	var current sql.NullString
+
+	if err := h.queryRow(ctx, currentDatabaseQuery, &current); err != nil {
+		logrus.Errorf("Error executing current database query: %v", err)
+		return CheckResult{}, true
+	}
+
+	if !current.Valid {
+		logrus.Warnf("Database %s does not exist.", h.dbName)
+		return CheckResult{Status: NotReady, Reason: ReasonDatabaseMissing}, false
+	}
+
+	return CheckResult{}, true
+}
+
+// checkOfflineMode reports whether the node is in service, returning the status to
+// report instead if an operator set offline_mode to drain it.  Servers without
+// offline_mode, such as MariaDB, are always considered in service.
+func (h *DBHandler) checkOfflineMode(ctx context.Context) (CheckResult, bool) {
+	var offline bool
+
+	err := h.queryRow(ctx, offlineModeQuery, &offline)
+
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownSystemVariable:
+		logrus.Debug("No offline_mode available, skipping offline mode check.")
+		return CheckResult{}, true
+	case err != nil:
+		logrus.Errorf("Error executing offline_mode query: %v", err)
+		return CheckResult{}, true
+	case offline:
+		logrus.Debug("Node is in offline_mode.")
+		return CheckResult{Status: NotReady, Reason: ReasonOfflineMode}, false
+	}
+
+	return CheckResult{}, true
+}
+
+// checkClone reports whether the node is clear of MySQL clone plugin activity,
+// returning the status to report instead if a clone is in progress or failed.
+// Servers without the clone plugin are always considered clear.
+func (h *DBHandler) checkClone(ctx context.Context) (CheckResult, bool) {
+	var state string
+
+	err := h.queryRow(ctx, cloneStatusQuery, &state)
+
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable:
+		logrus.Debug("No clone status available, skipping clone check.")
+		return CheckResult{}, true
+	case err != nil:
+		logrus.Errorf("Error executing clone_status query: %v", err)
+		return CheckResult{}, true
+	case state == cloneInProgress:
+		return CheckResult{Status: NotReady, Reason: ReasonCloneInProgress}, false
+	case state == cloneFailed:
+		return CheckResult{Status: Unavailable, Reason: ReasonCloneFailed}, false
+	}
+
+	return CheckResult{}, true
+}
+
+// checkQuorum downgrades result to NotReady if the node is the only member of its
+// cluster, which after a partition makes it a split-brain survivor whose writes
+// could later conflict.  The size of a Galera cluster is read from
+// wsrep_cluster_size, and that of a Group Replication group from its online
+// members.  Servers which are in neither kind of cluster are left unchanged.
+func (h *DBHandler) checkQuorum(ctx context.Context, result CheckResult) CheckResult {
+	clusterInfo, err := h.GetClusterInfo(ctx)
+	if err != nil {
+		logrus.Errorf("Error reading cluster info for quorum check: %v", err)
+		return result
+	}
+
+	size := clusterInfo.Size
+
+	if size == 0 {
+		err := h.queryRow(ctx, groupMembersQuery, &size)
+
+		var mysqlErr *mysql.MySQLError
+
+		switch {
+		case errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable:
+			logrus.Debug("No cluster membership available, skipping quorum check.")
+			return result
+		case err != nil:
+			logrus.Errorf("Error executing group members query: %v", err)
+			return result
+		}
+	}
+
+	if size == 1 {
+		logrus.Warn("Node is the only member of its cluster.")
+		return CheckResult{Status: NotReady, Reason: ReasonNoQuorum}
+	}
+
+	return result
+}
+
+// checkPrimaryComponent reports a synced node as not ready if its component is
+// not the primary one, as after a split-brain, and returns result otherwise.  The
+// status is read from the cluster info, which checkQuorum shares, and a node whose
+// status cannot be read is not ready.  Servers without wsrep_cluster_status are
+// left unchanged.
+func (h *DBHandler) checkPrimaryComponent(ctx context.Context, result CheckResult) CheckResult {
+	clusterInfo, err := h.GetClusterInfo(ctx)
+
+	switch {
+	case err != nil:
+		logrus.Errorf("Error reading wsrep cluster status: %v", err)
+		h.recordError(err)
+
+		return CheckResult{Status: NotReady}
+	case clusterInfo.Status == "":
+		logrus.Debug("No wsrep cluster status available, skipping primary component check.")
+	case clusterInfo.Status != clusterPrimary:
+		logrus.Warnf("Node is synced but its cluster component is %s.", clusterInfo.Status)
+		return CheckResult{Status: NotReady, Reason: ReasonNonPrimaryComponent}
+	}
+
+	return result
+}
+
+// checkDiskFull tells a read-only node that recently ran out of disk space from one
+// set read-only by an operator, by looking for disk full errors in the server's
+// error log.  Servers without performance_schema.error_log are left unchanged.
+func (h *DBHandler) checkDiskFull(ctx context.Context, result CheckResult) CheckResult {
+	var errorCount int
+
+	err := h.queryRow(ctx, diskFullQuery, &errorCount)
+
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable:
+		logrus.Debug("No error log table available, skipping disk full check.")
+	case err != nil:
+		logrus.Errorf("Error executing disk full query: %v", err)
+	case errorCount > 0:
+		logrus.Warnf("Read-only node logged %d disk full errors within the last hour.", errorCount)
+		return CheckResult{Status: ReadOnly, Reason: ReasonDiskFull}
+	}
+
+	return result
+}
+
+// checkBinlog reports a node which would take writes as not ready if binary
+// logging is disabled, since its writes would never reach the replicas, and
+// returns result otherwise.  Servers without log_bin are left unchanged.
+func (h *DBHandler) checkBinlog(ctx context.Context, result CheckResult) CheckResult {
+	var logBin sql.NullBool
+
+	err := h.queryRow(ctx, logBinQuery, &logBin)
+
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownSystemVariable:
+		logrus.Debug("No log_bin available, skipping binlog check.")
+	case err != nil:
+		logrus.Errorf("Error executing log_bin query: %v", err)
+	case logBin.Valid && !logBin.Bool:
+		logrus.Warn("Binary logging is disabled on a writable node.")
+		return CheckResult{Status: NotReady, Reason: ReasonBinlogDisabled}
+	}
+
+	return result
+}
+
+// checkSST reports a joining node receiving a State Snapshot Transfer with the
+// receiving_sst reason, as told by wsrep_local_state_comment, and returns result
+// otherwise.
+func (h *DBHandler) checkSST(ctx context.Context, result CheckResult) CheckResult {
+	if wsrepState, known := h.WsrepState(); !known || wsrepState != Joining {
+		return result
+	}
+
+	var variable, comment string
+
+	if err := h.queryRow(ctx, wsrepStateCommentQuery, &variable, &comment); err != nil {
+		logrus.Errorf("Error executing wsrep_local_state_comment query: %v", err)
+		return result
+	}
+
+	if strings.Contains(strings.ToLower(comment), receivingSSTComment) {
+		logrus.Debugf("Node is receiving a State Snapshot Transfer (%s).", comment)
+		return CheckResult{Status: NotReady, Reason: ReasonReceivingSST}
+	}
+
+	return result
+}
+
+// checkEviction reports whether the node is clear of eviction, returning the
+// Evicted status instead if the node's own UUID is on the cluster's EVS evict
+// list.
+func (h *DBHandler) checkEviction(ctx context.Context) (CheckResult, bool) {
+	variables, err := h.getStatusVariables(ctx, wsrepStatusQuery)
+	if err != nil {
+		logrus.Errorf("Error reading wsrep status for eviction check: %v", err)
+		return CheckResult{}, true
+	}
+
+	nodeUUID := variables["wsrep_gcomm_uuid"]
+	if nodeUUID == "" {
+		return CheckResult{}, true
+	}
+
+	for _, evictedUUID := range strings.Split(variables["wsrep_evs_evict_list"], ",") {
+		if strings.TrimSpace(evictedUUID) == nodeUUID {
+			logrus.Warnf("Node %s is on the cluster's evict list.", nodeUUID)
+			return CheckResult{Status: Evicted, Reason: ReasonEvicted}, false
+		}
+	}
+
+	return CheckResult{}, true
+}
+
+// checkClockSkew compares the clock of the database server against the local
+// clock and warns when they differ by more than options.max_clock_skew, since
+// skew corrupts lag calculations.  The result is downgraded to NotReady if
+// options.fail_on_clock_skew is set.
+func (h *DBHandler) checkClockSkew(ctx context.Context, result CheckResult) CheckResult {
+	skew, err := h.getClockSkew(ctx)
+	if err != nil {
+		logrus.Errorf("Error executing clock skew query: %v", err)
+		return result
+	}
+
+	logrus.Debugf("Measured clock skew of %s against the database server.", skew)
+
+	if skew > h.maxClockSkew || skew < -h.maxClockSkew {
+		logrus.Warnf("Clock skew of %s against the database server exceeds maximum of %s.", skew, h.maxClockSkew)
+
+		if h.failOnClockSkew {
+			return CheckResult{Status: NotReady, Reason: ReasonClockSkew}
+		}
+	}
+
+	return result
+}
+
+// getClockSkew returns how far the database server's clock is ahead of the local
+// clock, which is sampled halfway through the query to offset its round trip.
+func (h *DBHandler) getClockSkew(ctx context.Context) (time.Duration, error) {
+	var serverTime float64
+
+	before := time.Now()
+
+	if err := h.queryRow(ctx, serverTimeQuery, &serverTime); err != nil {
+		return 0, err
+	}
+
+	localTime := before.Add(time.Since(before) / 2)
+
+	return time.Duration(serverTime*float64(time.Second)) - time.Duration(localTime.UnixNano()), nil
+}
+
+// checkCommitProgress downgrades result to NotReady if wsrep_last_committed has
+// not advanced for longer than options.commit_progress_window while transactions
+// were waiting in the receive queue, which catches nodes that are synced but
+// frozen.  The window restarts whenever the node commits or its queue is empty,
+// so an idle cluster is never reported.
+func (h *DBHandler) checkCommitProgress(ctx context.Context, result CheckResult) CheckResult {
+	variables, err := h.getStatusVariables(ctx, wsrepStatusQuery)
+	if err != nil {
+		logrus.Errorf("Error reading wsrep status for commit progress check: %v", err)
+		return result
+	}
+
+	lastCommitted, err := strconv.ParseInt(variables["wsrep_last_committed"], 10, 64)
+	if err != nil {
+		logrus.Errorf("Error parsing wsrep_last_committed: %v", err)
+		return result
+	}
+
+	recvQueue, _ := strconv.Atoi(variables["wsrep_local_recv_queue"])
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+
+	if h.lastCommittedAt.IsZero() || lastCommitted != h.lastCommitted || recvQueue == 0 {
+		h.lastCommitted = lastCommitted
+		h.lastCommittedAt = now
+
+		return result
+	}
+
+	if stalled := now.Sub(h.lastCommittedAt); stalled > h.commitProgressWindow {
+		logrus.Warnf("wsrep_last_committed has not advanced from %d in %s with %d transactions queued.",
+			lastCommitted, stalled, recvQueue)
+
+		return CheckResult{Status: NotReady, Reason: ReasonStalled}
+	}
+
+	return result
+}
+
+// checkSeqnoGap downgrades result to Lagging if the local wsrep_last_committed is
+// more than options.max_seqno_gap behind the cluster's committed position.  A
+// node cannot read the seqno of its peers, so the cluster position is estimated
+// as the local position plus the write-sets received but not yet applied
+// (wsrep_local_recv_queue).  Write-sets the node has not received yet are not
+// counted, although flow control keeps those few.
+func (h *DBHandler) checkSeqnoGap(ctx context.Context, result CheckResult) CheckResult {
+	variables, err := h.getStatusVariables(ctx, wsrepStatusQuery)
+	if err != nil {
+		logrus.Errorf("Error reading wsrep status for seqno gap check: %v", err)
+		return result
+	}
+
+	lastCommitted, err := strconv.ParseInt(variables["wsrep_last_committed"], 10, 64)
+	if err != nil {
+		logrus.Errorf("Error parsing wsrep_last_committed: %v", err)
+		return result
+	}
+
+	recvQueue, err := strconv.ParseInt(variables["wsrep_local_recv_queue"], 10, 64)
+	if err != nil {
+		logrus.Errorf("Error parsing wsrep_local_recv_queue: %v", err)
+		return result
+	}
+
+	if recvQueue > h.maxSeqnoGap {
+		logrus.Debugf("wsrep_last_committed %d is %d behind the cluster, more than the maximum of %d.",
+			lastCommitted, recvQueue, h.maxSeqnoGap)
+
+		return CheckResult{Status: Lagging, Reason: ReasonSeqnoGap}
+	}
+
+	return result
+}
+
+// checkHeartbeat downgrades result to Lagging if the latest heartbeat written to
+// the configured heartbeat table is older than options.heartbeat.max_lag.
+func (h *DBHandler) checkHeartbeat(ctx context.Context, result CheckResult) CheckResult {
+	lag, err := h.getHeartbeatLag(ctx)
+
+	switch {
+	case err != nil:
+		logrus.Errorf("Error reading heartbeat table %s: %v", h.heartbeatTable, err)
+		return CheckResult{Status: NotReady, Reason: ReasonHeartbeatMissing}
+	case lag > h.heartbeatMaxLag:
+		logrus.Debugf("Heartbeat lag %s exceeds maximum of %s.", lag, h.heartbeatMaxLag)
+		return CheckResult{Status: Lagging}
+	}
+
+	return result
+}
+
+// checkReplicationLag downgrades result to NotReady if the node is an async replica
+// more than options.max_replication_lag seconds behind its source, or whose lag
+// is unknown.  Nodes which are not replicas are left unchanged.
+func (h *DBHandler) checkReplicationLag(ctx context.Context, result CheckResult) CheckResult {
+	lag, ok := h.getReplicationLag(ctx)
+
+	switch {
+	case !ok:
+		return CheckResult{Status: NotReady, Reason: ReasonReplicationStopped}
+	case lag > h.maxReplicationLag:
+		logrus.Debugf("Replication lag of %ds exceeds maximum of %ds.", lag, h.maxReplicationLag)
+		return CheckResult{Status: NotReady, Reason: ReasonReplicationLag}
+	}
+
+	return result
+}
+
+// getReplicationLag queries the replica status from the database server and
+// returns Seconds_Behind_Master.  A lag of zero is returned for a server which
+// is not a replica, and false if the lag is NULL or the query fails.
+func (h *DBHandler) getReplicationLag(ctx context.Context) (int, bool) {
+	var lag sql.NullInt64
+
+	isReplica := false
+
+	err := h.queryRows(ctx, slaveStatusQuery, func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+
+		values := make([]interface{}, len(columns))
+		found := false
+
+		for i, column := range columns {
+			if column == secondsBehindMasterColumn {
+				values[i] = &lag
+				found = true
+			} else {
+				values[i] = new(sql.RawBytes)
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("column %s not found", secondsBehindMasterColumn)
+		}
+
+		isReplica = true
+
+		return rows.Scan(values...)
+	})
+
+	switch {
+	case err != nil:
+		logrus.Errorf("Error executing slave status query: %v", err)
+		return 0, false
+	case !isReplica:
+		return 0, true
+	case !lag.Valid:
+		logrus.Warn("Replication lag is unknown, replication is not running.")
+		return 0, false
+	}
+
+	return int(lag.Int64), true
+}
+
+// checkPrimary reports nodes which cannot take writes as not ready, regardless of
+// options.available_when_readonly, and returns result otherwise.  In
+// group_replication cluster mode, the node must also be the PRIMARY of its group.
+// A read-only node keeps the reason it was reported with, such as disk_full.
+func (h *DBHandler) checkPrimary(ctx context.Context, result CheckResult) CheckResult {
+	writable := result.Status == Available
+
+	if writable && (h.availableWhenReadOnly || h.runsCustomQuery()) {
+		// The read-only mode was not looked up by the main check.
+		readOnly, _ := h.isReadOnly(ctx)
+		writable = !readOnly
+	}
+
+	if writable && h.clusterMode == clusterModeGroupReplication {
+		var memberRole string
+
+		if err := h.queryRow(ctx, groupMemberRoleQuery, &memberRole); err != nil {
+			logrus.Errorf("Error executing Group Replication member role query: %v", err)
+		}
+
+		writable = memberRole == groupMemberPrimary
+	}
+
+	if writable {
+		return result
+	}
+
+	logrus.Debug("Node is not a writable primary.")
+
+	if result.Reason != "" {
+		return CheckResult{Status: NotReady, Reason: result.Reason}
+	}
+
+	return CheckResult{Status: NotReady, Reason: ReasonNotPrimary}
+}
+
+// checkReadWrite downgrades result unless the node answers a read probe and
+// accepts a write to the scratch table within options.read_write.timeout.  The
+// write is rolled back, so the scratch table stays empty.
+func (h *DBHandler) checkReadWrite(ctx context.Context, result CheckResult) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.readWriteTimeout)
+	defer cancel()
+
+	var one int
+
+	if err := h.queryRow(ctx, readProbeQuery, &one); err != nil {
+		logrus.Errorf("Error executing read probe: %v", err)
+		return CheckResult{Status: NotReady, Reason: ReasonReadFailed}
+	}
+
+	err := h.probeWrite(ctx)
+
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case err == nil:
+		return result
+	case isWsrepNotReady(err):
+		return CheckResult{Status: NotReady, Reason: ReasonWsrepNotReady}
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errOptionPreventsStatement:
+		return CheckResult{Status: ReadOnly}
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable:
+		logrus.Errorf("Scratch table %s for the write probe does not exist, "+
+			"create it as an InnoDB table whose columns all have defaults: %v", h.scratchTable, err)
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errTableAccessDenied:
+		logrus.Errorf("User lacks the INSERT privilege on scratch table %s for the write probe: %v",
+			h.scratchTable, err)
+	default:
+		logrus.Errorf("Error executing write probe: %v", err)
+	}
+
+	return CheckResult{Status: NotReady, Reason: ReasonWriteFailed}
+}
+
+// probeWrite inserts a row into the scratch table in a transaction which is then
+// rolled back.
+func (h *DBHandler) probeWrite(ctx context.Context) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			logrus.Errorf("Error rolling back write probe: %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(writeProbeQuery, quoteIdentifier(h.scratchTable)))
+
+	return err
+}
+
+// getHeartbeatLag returns the time elapsed since the latest heartbeat timestamp in
+// the configured heartbeat table.  Timestamps must be written in UTC, as done by
+// pt-heartbeat.
+func (h *DBHandler) getHeartbeatLag(ctx context.Context) (time.Duration, error) {
+	query := fmt.Sprintf(heartbeatQuery, quoteIdentifier(h.heartbeatColumn), quoteIdentifier(h.heartbeatTable))
+
+	var lag sql.NullInt64
+
+	if err := h.queryRow(ctx, query, &lag); err != nil {
+		return 0, err
+	}
+
+	if !lag.Valid {
+		return 0, errors.New("heartbeat table is empty")
+	}
+
+	return time.Duration(lag.Int64) * time.Microsecond, nil
+}
+
+// quoteIdentifier quotes a possibly schema-qualified identifier for use in a query.
+func quoteIdentifier(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.ReplaceAll(part, "`", "``") + "`"
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// GetClusterInfo returns the wsrep cluster membership details, fetched in a
+// single status query and cached for clusterInfoTTL.
+func (h *DBHandler) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
+	h.mu.Lock()
+	if h.clusterInfo != nil && time.Since(h.clusterInfoAt) < clusterInfoTTL {
+		defer h.mu.Unlock()
+		return h.clusterInfo, nil
+	}
+	h.mu.Unlock()
+
+	variables, err := h.getStatusVariables(ctx, wsrepStatusQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterInfo := newClusterInfo(variables)
+
+	h.mu.Lock()
+	h.clusterInfo = clusterInfo
+	h.clusterInfoAt = time.Now()
+	h.mu.Unlock()
+
+	return clusterInfo, nil
+}
+
+// newClusterInfo returns the cluster info held by the wsrep status variables.
+func newClusterInfo(variables map[string]string) *ClusterInfo {
+	clusterInfo := &ClusterInfo{
+		Status:    variables["wsrep_cluster_status"],
+		StateUUID: variables["wsrep_cluster_state_uuid"],
+	}
+	clusterInfo.Size, _ = strconv.Atoi(variables["wsrep_cluster_size"])
+	clusterInfo.LocalIndex, _ = strconv.Atoi(variables["wsrep_local_index"])
+
+	return clusterInfo
+}
+
+// GetClusterHealth reports whether the cluster as seen by the local node is healthy:
+// it is the primary component, so it has quorum, and holds at least
+// options.cluster_min_size nodes.  The cluster info is returned alongside.
+func (h *DBHandler) GetClusterHealth(ctx context.Context) (bool, *ClusterInfo, error) {
+	clusterInfo, err := h.GetClusterInfo(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return clusterInfo.Status == clusterPrimary && clusterInfo.Size >= h.clusterMinSize, clusterInfo, nil
+}
+
+// getStatusVariables runs a SHOW STATUS or SHOW VARIABLES query and returns the
+// resulting name/value pairs, so several variables can be fetched in one round
+// trip.  Variables which the server did not return are absent from the map.
+func (h *DBHandler) getStatusVariables(ctx context.Context, query string) (map[string]string, error) {
+	variables := make(map[string]string)
+
+	err := h.queryRows(ctx, query, func(rows *sql.Rows) error {
+		var variable string
+
+		var value sql.NullString
+
+		if err := rows.Scan(&variable, &value); err != nil {
+			return err
+		}
+
+		variables[variable] = value.String
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error executing status query: %w", err)
+	}
+
+	return variables, nil
+}
+
+// queryRow runs a query returning a single row and scans it into dest.  The query
+// runs as a prepared statement unless connection.disable_prepared_statements is
+// set, since some proxies handle prepared statements poorly.  Transient failures
+// are retried as configured by options.retry_attempts.
+func (h *DBHandler) queryRow(ctx context.Context, query string, dest ...interface{}) error {
+	return h.retry(ctx, func() error { return h.queryRowOnce(ctx, query, dest...) })
+}
+
+// queryRowOnce runs a single attempt of queryRow.
+func (h *DBHandler) queryRowOnce(ctx context.Context, query string, dest ...interface{}) error {
+	if h.disablePreparedStatements {
+		return h.db.QueryRowContext(ctx, query).Scan(dest...)
+	}
+
+	stmtOut, err := h.db.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error preparing statement: %w", err)
+	}
+
+	defer func() {
+		if err := stmtOut.Close(); err != nil {
+			logrus.Errorf("Error closing prepared statement: %v", err)
+		}
+	}()
+
+	return stmtOut.QueryRowContext(ctx).Scan(dest...)
+}
+
+// queryRows runs a query with args and calls scan for each row of the result.  As
+// with queryRow, a prepared statement is used unless disabled, and transient
+// failures are retried, unless rows were already scanned, since scan cannot take
+// them back.
+func (h *DBHandler) queryRows(ctx context.Context, query string, scan func(*sql.Rows) error,
+	args ...interface{}) error {
+	var err error
+
+	retryErr := h.retry(ctx, func() error {
+		var scanned bool
+
+		err = h.queryRowsOnce(ctx, query, func(rows *sql.Rows) error {
+			scanned = true
+			return scan(rows)
+		}, args...)
+
+		if scanned {
+			return nil
+		}
+
+		return err
+	})
+	if retryErr != nil {
+		return retryErr
+	}
+
+	return err
+}
+
+// queryRowsOnce runs a single attempt of queryRows.
+func (h *DBHandler) queryRowsOnce(ctx context.Context, query string, scan func(*sql.Rows) error,
+	args ...interface{}) error {
+	var rows *sql.Rows
+
+	var err error
+
+	if h.disablePreparedStatements {
+		rows, err = h.db.QueryContext(ctx, query, args...)
+	} else {
+		var stmtOut *sql.Stmt
+
+		stmtOut, err = h.db.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("error preparing statement: %w", err)
+		}
+
+		defer func() {
+			if err := stmtOut.Close(); err != nil {
+				logrus.Errorf("Error closing prepared statement: %v", err)
+			}
+		}()
+
+		rows, err = stmtOut.QueryContext(ctx, args...)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// countPlaceholders returns the number of ? placeholders in query, ignoring those
+// within quoted strings, quoted identifiers and comments.
+func countPlaceholders(query string) int {
+	count := 0
+
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '?':
+			count++
+		case c == '\'', c == '"', c == '`':
+			// Skip to the closing quote, past escaped and doubled quotes.
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' && c != '`' {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+		}
+	}
+
+	return count
+}
+
+// getCustomRequest runs the custom checks in order, and reports the node as
+// available only if all of them pass.  It stops at the first failing check.
+func (h *DBHandler) getCustomRequest(ctx context.Context) CheckResult {
+	start := time.Now()
+	defer func() { h.recordCustomQueryDuration(time.Since(start)) }()
+
+	checks := h.customCheckList()
+
+	for i, check := range checks {
+		if result := h.runCustomCheck(ctx, check); result.Status != Available {
+			logrus.Warnf("Custom check %d of %d failed: %s", i+1, len(checks), check.query)
+			return result
+		}
+	}
+
+	return CheckResult{Status: Available}
+}
+
+// customCheckList returns the checks of options.checks, or else the check made of
+// customQuery, customQueryArgs and customResult if set.
+func (h *DBHandler) customCheckList() []customCheck {
+	if len(h.customChecks) > 0 {
+		return h.customChecks
+	}
+
+	if h.customQuery == "" {
+		return nil
+	}
+
+	return []customCheck{{query: h.customQuery, args: h.customQueryArgs, expectedResult: h.customResult}}
+}
+
+// runsCustomQuery returns whether health checks run custom checks rather than the
+// wsrep or Group Replication checks.
+func (h *DBHandler) runsCustomQuery() bool {
+	return h.customQuery != "" || len(h.customChecks) > 0
+}
+
+// errResultTooLarge stops reading a custom query result holding a value longer
+// than customResultMaxLength.
+var errResultTooLarge = errors.New("custom query result is too large")
+
+// runCustomCheck runs the query of check and compares the first column of its
+// rows with its expected result as per customResultRowMode.  Columns of any type
+// and number are read as raw bytes, so integer results and extra columns are
+// accepted.  The query is reported unavailable if it runs longer than
+// options.custom_query_timeout, within the check_timeout of the whole check.
+func (h *DBHandler) runCustomCheck(ctx context.Context, check customCheck) CheckResult {
+	logrus.Debugf("Executing custom query: %s", check.query)
+
+	if h.customQueryTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, h.customQueryTimeout)
+		defer cancel()
+	}
+
+	// RawBytes avoids copying a value which is too large to be a health result.
+	var values []sql.RawBytes
+
+	var dest []interface{}
+
+	// All rows are read in every mode, so the connection is released cleanly.
+	var rows, matches int
+
+	var firstMatches bool
+
+	err := h.queryRows(ctx, check.query, func(result *sql.Rows) error {
+		if dest == nil {
+			columns, err := result.Columns()
+			if err != nil {
+				return fmt.Errorf("error reading custom query columns: %w", err)
+			}
+
+			values = make([]sql.RawBytes, len(columns))
+			dest = make([]interface{}, len(columns))
+
+			for i := range values {
+				dest[i] = &values[i]
+			}
+		}
+
+		if err := result.Scan(dest...); err != nil {
+			return fmt.Errorf("error scanning custom query result: %w", err)
+		}
+
+		for _, value := range values {
+			if h.customResultMaxLength > 0 && len(value) > h.customResultMaxLength {
+				logrus.Errorf("Result of row %d is %d bytes long, more than the customResultMaxLength of %d bytes",
+					rows+1, len(value), h.customResultMaxLength)
+				return errResultTooLarge
+			}
+		}
+
+		var queryResult string
+		if len(values) > 0 {
+			queryResult = string(values[0])
+		}
+
+		rowMatches := matchesCustomResult(check.expectedResult, queryResult)
+		if rowMatches {
+			matches++
+		} else {
+			logrus.Debugf("Result of row %d is incorrect : '%s' != '%s'", rows+1, queryResult, check.expectedResult)
+		}
+
+		if rows == 0 {
+			firstMatches = rowMatches
+		}
+
+		rows++
+
+		return nil
+	}, check.args...)
+
+	switch {
+	case errors.Is(err, errResultTooLarge):
+		return CheckResult{Status: NotReady, Reason: ReasonResultTooLarge}
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		logrus.Errorf("Custom query timed out: %s", check.query)
+		return CheckResult{Status: Unavailable}
+	case err != nil:
+		logrus.Errorf("Error executing custom query: %v", err)
+		h.recordError(err)
+
+		if isWsrepNotReady(err) {
+			return CheckResult{Status: NotReady, Reason: ReasonWsrepNotReady}
+		}
+
+		return CheckResult{Status: NotReady}
+	case rows == 0:
+		logrus.Errorf("No query result")
+		return CheckResult{Status: NotReady}
+	}
+
+	var ok bool
+
+	switch h.customResultRowMode {
+	case rowModeAllMatch:
+		ok = matches == rows
+	case rowModeAnyMatch:
+		ok = matches > 0
+	default:
+		ok = firstMatches
+	}
+
+	if !ok {
+		logrus.Errorf("Result is incorrect : %d of %d rows match '%s' in %s mode", matches, rows, check.expectedResult,
+			h.customResultRowMode)
+		return CheckResult{Status: NotReady}
+	}
+
+	return CheckResult{Status: Available}
+}
+
+// matchesCustomResult returns whether a row of a custom query result is healthy.
+// Surrounding whitespace is ignored, and every row is healthy if expectedResult is
+// empty.
+func matchesCustomResult(expectedResult, queryResult string) bool {
+	return expectedResult == "" || strings.TrimSpace(queryResult) == expectedResult
+}
+
+// isReadOnly queries the global variable read_only from the database server
+// and returns whether the server is in read-only mode.  The server is assumed
+// to be read-only if the query fails.
+func (h *DBHandler) isReadOnly(ctx context.Context) (bool, error) {
+	var variable string
+
+	var value string
+
+	if err := h.queryRow(ctx, readOnlyQuery, &variable, &value); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			logrus.Errorf("Error executing read_only query: %v", err)
+			h.recordError(err)
+		}
+
+		return true, err
+	}
+
+	return value != "OFF", nil
 }
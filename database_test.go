@@ -1,15 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/viper"
 )
 
 func TestCreateDBHandler(t *testing.T) {
-	config := CreateConfig()
+	config := CreateConfig("")
 
 	db, err := sql.Open("mysql", "/") // Using an actual sql.DB here as placeholder
 	if err != nil {
@@ -22,8 +41,8 @@ func TestCreateDBHandler(t *testing.T) {
 		t.Error("DBHandler.db not pointing to provided *sql.DB instance.")
 	}
 
-	if dbHandler.availableWhenDonor != config.GetBool("options.available_when_donor") {
-		t.Error("DBHandler.availableWhenDonor does not match provided config.")
+	if dbHandler.availableStates[Donor] != config.GetBool("options.available_when_donor") {
+		t.Error("DBHandler.availableStates does not match options.available_when_donor.")
 	}
 
 	if dbHandler.availableWhenReadOnly != config.GetBool("options.available_when_readonly") {
@@ -32,8 +51,12 @@ func TestCreateDBHandler(t *testing.T) {
 }
 
 func TestBuildDSN(t *testing.T) {
-	config := CreateConfig()
-	dsn := BuildDSN(config)
+	config := CreateConfig("")
+	dsn, err := BuildDSN(config)
+	if err != nil {
+		t.Fatalf("BuildDSN() failed: %v", err)
+	}
+
 	defaultDSN := mysql.NewConfig().FormatDSN()
 
 	if len(dsn) == 0 {
@@ -45,6 +68,54 @@ func TestBuildDSN(t *testing.T) {
 	}
 }
 
+func TestBuildDSNTLSEnforced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "healthcheck.yaml")
+
+	if err := os.WriteFile(path, []byte("connection:\n  tls:\n    enforced: true\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		sessionResumption  bool
+		expectedTLSSetting string
+	}{
+		{"with session resumption", true, "tls=" + customTLSConfigName},
+		{"without session resumption", false, "tls=true"},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig(path)
+		config.Set("connection.tls.session_resumption", test.sessionResumption)
+
+		if dsn := mustBuildDSN(t, config); !strings.Contains(dsn, test.expectedTLSSetting) {
+			t.Errorf("Expected connection.tls.enforced %s to enable TLS with %s but received DSN %s.",
+				test.name, test.expectedTLSSetting, dsn)
+		}
+	}
+
+	// The deprecated key is an alias of connection.tls.required when set at runtime too.
+	config := CreateConfig("")
+	config.Set("connection.tls.session_resumption", false)
+	config.Set("connection.tls.enforced", true)
+
+	if dsn := mustBuildDSN(t, config); !strings.Contains(dsn, "tls=true") {
+		t.Errorf("Expected connection.tls.enforced set at runtime to enable TLS but received DSN %s.", dsn)
+	}
+}
+
+// mustBuildDSN returns the DSN built from config, failing the test if it cannot be.
+func mustBuildDSN(t *testing.T, config *viper.Viper) string {
+	t.Helper()
+
+	dsn, err := BuildDSN(config)
+	if err != nil {
+		t.Fatalf("BuildDSN() failed: %v", err)
+	}
+
+	return dsn
+}
+
 func getMockRow(val1 interface{}, val2 interface{}) *sqlmock.Rows {
 	return sqlmock.NewRows([]string{"variable", "value"}).AddRow(val1, val2)
 }
@@ -58,13 +129,9 @@ func TestGetWsrepLocalState(t *testing.T) {
 	mock.ExpectPrepare(wsrepLocalStateQuery)
 	mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
 
-	dbHandler := &DBHandler{
-		db,
-		false,
-		false,
-	}
+	dbHandler := &DBHandler{db: db}
 
-	wsrepStatus := dbHandler.getWsrepLocalState()
+	wsrepStatus, _ := dbHandler.getWsrepLocalState(context.Background())
 
 	if wsrepStatus != Synced {
 		t.Errorf("Expected WsrepStatus \"Synced\" but received \"%v\".", wsrepStatus)
@@ -77,13 +144,9 @@ func TestOfflinegetWsrepLocalState(t *testing.T) {
 		t.Errorf("Failed to open database: %v", err)
 	}
 
-	dbHandler := &DBHandler{
-		db,
-		false,
-		false,
-	}
+	dbHandler := &DBHandler{db: db}
 
-	wsrepStatus := dbHandler.getWsrepLocalState()
+	wsrepStatus, _ := dbHandler.getWsrepLocalState(context.Background())
 
 	if wsrepStatus != Joining {
 		t.Errorf("Expected WsrepStatus \"Joining\" due to server being offline but received \"%v\".", wsrepStatus)
@@ -99,13 +162,9 @@ func TestIsReadOnly(t *testing.T) {
 	mock.ExpectPrepare(readOnlyQuery)
 	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
 
-	dbHandler := &DBHandler{
-		db,
-		false,
-		false,
-	}
+	dbHandler := &DBHandler{db: db}
 
-	if dbHandler.isReadOnly() {
+	if readOnly, _ := dbHandler.isReadOnly(context.Background()); readOnly {
 		t.Error("Database is read-write but isReadOnly() returned true.")
 	}
 }
@@ -122,11 +181,7 @@ func TestSyncedRWStatus(t *testing.T) {
 	mock.ExpectPrepare(readOnlyQuery)
 	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
 
-	dbHandler := &DBHandler{
-		db,
-		false,
-		false,
-	}
+	dbHandler := &DBHandler{db: db}
 
 	ready, msg := RunStatusCheck(dbHandler)
 
@@ -135,6 +190,39 @@ func TestSyncedRWStatus(t *testing.T) {
 	}
 }
 
+func TestMaintenanceFile(t *testing.T) {
+	maintenanceFile := filepath.Join(t.TempDir(), "maintenance")
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db, maintenanceFile: maintenanceFile}
+
+	expectSyncedRW(mock)
+
+	if ready, msg := RunStatusCheck(dbHandler); !ready {
+		t.Errorf("Expected database to be available without the maintenance file but received %q.", msg)
+	}
+
+	if err := os.WriteFile(maintenanceFile, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create maintenance file: %v", err)
+	}
+
+	if ready, msg := RunStatusCheck(dbHandler); ready || msg != reasonMessages[ReasonMaintenance] {
+		t.Errorf("Expected the maintenance message with the maintenance file but received %v %q.", ready, msg)
+	}
+
+	if result := dbHandler.GetStrictStatus(); result.Reason != ReasonMaintenance {
+		t.Errorf("Expected strict checks to report maintenance but received %+v.", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestIsConnected(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
 	if err != nil {
@@ -143,11 +231,7 @@ func TestIsConnected(t *testing.T) {
 
 	mock.ExpectPing()
 
-	dbHandler := &DBHandler{
-		db,
-		false,
-		false,
-	}
+	dbHandler := &DBHandler{db: db}
 
 	if !dbHandler.isConnected() {
 		t.Errorf("Expected database to be connected but isConnected() returned false.")
@@ -160,11 +244,7 @@ func TestDBOffline(t *testing.T) {
 		t.Errorf("Failed to open database: %v", err)
 	}
 
-	dbHandler := &DBHandler{
-		db,
-		false,
-		false,
-	}
+	dbHandler := &DBHandler{db: db}
 
 	ready, _ := RunStatusCheck(dbHandler)
 
@@ -172,3 +252,2607 @@ func TestDBOffline(t *testing.T) {
 		t.Error("Expected database to be unavailable but RunStatusCheck returned true.")
 	}
 }
+
+func TestSlowStartWeight(t *testing.T) {
+	dbHandler := &DBHandler{slowStartDuration: time.Minute}
+
+	dbHandler.trackAvailability(Unavailable)
+	dbHandler.trackAvailability(Available)
+
+	if weight := dbHandler.Weight(Available); weight >= maxWeight {
+		t.Errorf("Expected a reduced weight for a freshly available node but received %d.", weight)
+	}
+
+	dbHandler.availableSince = time.Now().Add(-time.Minute / 2)
+
+	if weight := dbHandler.Weight(Available); weight < 45 || weight > 55 {
+		t.Errorf("Expected a weight of about 50 halfway through slow start but received %d.", weight)
+	}
+
+	dbHandler.availableSince = time.Now().Add(-time.Minute)
+
+	if weight := dbHandler.Weight(Available); weight != maxWeight {
+		t.Errorf("Expected full weight after slow start but received %d.", weight)
+	}
+
+	if weight := dbHandler.Weight(NotReady); weight != 0 {
+		t.Errorf("Expected zero weight for a node that is not ready but received %d.", weight)
+	}
+}
+
+func TestSlowStartWeightWarmStart(t *testing.T) {
+	dbHandler := &DBHandler{slowStartDuration: time.Minute}
+
+	dbHandler.trackAvailability(Available)
+
+	if weight := dbHandler.Weight(Available); weight != maxWeight {
+		t.Errorf("Expected full weight for a node available on the first check but received %d.", weight)
+	}
+}
+
+func TestWsrepNotReadyStatus(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing()
+	mock.ExpectPrepare(wsrepLocalStateQuery)
+	mock.ExpectQuery(wsrepLocalStateQuery).WillReturnError(&mysql.MySQLError{
+		Number:  errWsrepNotReady,
+		Message: "WSREP has not yet prepared node for application use",
+	})
+
+	dbHandler := &DBHandler{db: db}
+
+	result := dbHandler.GetStatus()
+
+	if result.Status != NotReady || result.Reason != ReasonWsrepNotReady {
+		t.Errorf("Expected NotReady with reason %q but received status %v with reason %q.",
+			ReasonWsrepNotReady, result.Status, result.Reason)
+	}
+}
+
+func TestGetStatusVariables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPrepare(wsrepStatusQuery)
+	mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).
+		AddRow("wsrep_local_state", "4").
+		AddRow("wsrep_ready", "ON").
+		AddRow("wsrep_cluster_status", "Primary").
+		AddRow("wsrep_flow_control_paused", nil))
+
+	dbHandler := &DBHandler{db: db}
+
+	variables, err := dbHandler.getStatusVariables(context.Background(), wsrepStatusQuery)
+	if err != nil {
+		t.Errorf("Expected status variables but received error: %v", err)
+	}
+
+	expected := map[string]string{
+		"wsrep_local_state":         "4",
+		"wsrep_ready":               "ON",
+		"wsrep_cluster_status":      "Primary",
+		"wsrep_flow_control_paused": "",
+	}
+
+	for variable, value := range expected {
+		if actual, ok := variables[variable]; !ok || actual != value {
+			t.Errorf("Expected %s to be \"%s\" but received \"%s\".", variable, value, actual)
+		}
+	}
+
+	if _, ok := variables["wsrep_cluster_size"]; ok {
+		t.Error("Expected wsrep_cluster_size to be absent from a partial result.")
+	}
+}
+
+func TestGetStatusVariablesError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPrepare(wsrepStatusQuery)
+	mock.ExpectQuery(wsrepStatusQuery).WillReturnError(sql.ErrConnDone)
+
+	dbHandler := &DBHandler{db: db}
+
+	if _, err := dbHandler.getStatusVariables(context.Background(), wsrepStatusQuery); err == nil {
+		t.Error("Expected an error from a failed status query but received none.")
+	}
+}
+
+func expectConcurrentChecks(mock sqlmock.Sqlmock, wsrepState WsrepStatus, readOnly string, delay time.Duration) {
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectPing()
+	mock.ExpectPrepare(wsrepLocalStateQuery)
+	mock.ExpectQuery(wsrepLocalStateQuery).WillDelayFor(delay).
+		WillReturnRows(getMockRow("wsrep_local_state", wsrepState))
+	mock.ExpectPrepare(readOnlyQuery)
+	mock.ExpectQuery(readOnlyQuery).WillDelayFor(delay).
+		WillReturnRows(getMockRow("read_only", readOnly))
+}
+
+func TestConcurrentChecks(t *testing.T) {
+	tests := []struct {
+		wsrepState         WsrepStatus
+		readOnly           string
+		availableWhenDonor bool
+		expected           ServerStatus
+	}{
+		{Synced, "OFF", false, Available},
+		{Synced, "ON", false, ReadOnly},
+		{Donor, "OFF", false, NotReady},
+		{Donor, "OFF", true, Available},
+		{Donor, "ON", true, ReadOnly},
+		{Joining, "OFF", false, NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		expectConcurrentChecks(mock, test.wsrepState, test.readOnly, 0)
+
+		dbHandler := &DBHandler{
+			db:               db,
+			availableStates:  map[WsrepStatus]bool{Synced: true, Donor: test.availableWhenDonor},
+			concurrentChecks: true,
+		}
+
+		if status := dbHandler.GetStatus().Status; status != test.expected {
+			t.Errorf("Expected status %v for wsrep state %v and read_only %s but received %v.",
+				test.expected, test.wsrepState, test.readOnly, status)
+		}
+	}
+}
+
+func benchmarkChecks(b *testing.B, concurrent bool) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+	if err != nil {
+		b.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db, concurrentChecks: concurrent}
+
+	for i := 0; i < b.N; i++ {
+		expectConcurrentChecks(mock, Synced, "OFF", 5*time.Millisecond)
+
+		if status := dbHandler.GetStatus().Status; status != Available {
+			b.Errorf("Expected status Available but received %v.", status)
+		}
+	}
+}
+
+func BenchmarkSequentialChecks(b *testing.B) {
+	benchmarkChecks(b, false)
+}
+
+func BenchmarkConcurrentChecks(b *testing.B) {
+	benchmarkChecks(b, true)
+}
+
+func TestSuccessThreshold(t *testing.T) {
+	dbHandler := &DBHandler{successThreshold: 3}
+
+	for i := 1; i < 3; i++ {
+		if result := dbHandler.applySuccessThreshold(CheckResult{Status: Available}); result.Status != NotReady {
+			t.Errorf("Expected NotReady after %d successful checks but received %v.", i, result.Status)
+		}
+	}
+
+	if result := dbHandler.applySuccessThreshold(CheckResult{Status: Available}); result.Status != Available {
+		t.Errorf("Expected Available after 3 successful checks but received %v.", result.Status)
+	}
+
+	dbHandler.applySuccessThreshold(CheckResult{Status: Unavailable})
+
+	if result := dbHandler.applySuccessThreshold(CheckResult{Status: Available}); result.Status != NotReady {
+		t.Errorf("Expected NotReady after a failed check reset the streak but received %v.", result.Status)
+	}
+}
+
+func TestCheckHeartbeat(t *testing.T) {
+	tests := []struct {
+		rows     *sqlmock.Rows
+		err      error
+		expected CheckResult
+	}{
+		{sqlmock.NewRows([]string{"lag"}).AddRow(int64(2 * time.Second / time.Microsecond)),
+			nil, CheckResult{Status: Available}},
+		{sqlmock.NewRows([]string{"lag"}).AddRow(int64(time.Minute / time.Microsecond)),
+			nil, CheckResult{Status: Lagging}},
+		{sqlmock.NewRows([]string{"lag"}).AddRow(nil),
+			nil, CheckResult{Status: NotReady, Reason: ReasonHeartbeatMissing}},
+		{nil, &mysql.MySQLError{Number: 1146, Message: "Table 'percona.heartbeat' doesn't exist"},
+			CheckResult{Status: NotReady, Reason: ReasonHeartbeatMissing}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		heartbeatQuery := "SELECT TIMESTAMPDIFF(MICROSECOND, MAX(`ts`), UTC_TIMESTAMP(6)) FROM `percona`.`heartbeat`;"
+		mock.ExpectPrepare(heartbeatQuery)
+		query := mock.ExpectQuery(heartbeatQuery)
+		if test.err != nil {
+			query.WillReturnError(test.err)
+		} else {
+			query.WillReturnRows(test.rows)
+		}
+
+		dbHandler := &DBHandler{
+			db:              db,
+			heartbeatTable:  "percona.heartbeat",
+			heartbeatColumn: "ts",
+			heartbeatMaxLag: 10 * time.Second,
+		}
+
+		if result := dbHandler.checkHeartbeat(context.Background(), CheckResult{Status: Available}); result != test.expected {
+			t.Errorf("Expected %+v but received %+v.", test.expected, result)
+		}
+	}
+}
+
+func TestIsConnectedValidationQuery(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	dbHandler := &DBHandler{db: db, validationQuery: "SELECT 1"}
+
+	if !dbHandler.isConnected() {
+		t.Errorf("Expected database to be connected but isConnected() returned false.")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected validation query to be run instead of a ping: %v", err)
+	}
+}
+
+func TestDisablePreparedStatements(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+
+	dbHandler := &DBHandler{
+		db:                        db,
+		validationQuery:           "SELECT 1",
+		disablePreparedStatements: true,
+	}
+
+	if status := dbHandler.GetStatus().Status; status != Available {
+		t.Errorf("Expected status Available through a proxy but received %v.", status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected queries to run without prepared statements: %v", err)
+	}
+}
+
+func TestStartupGrace(t *testing.T) {
+	db, err := sql.Open("mysql", "/") // Using an actual sql.DB here to simulate database still starting
+	if err != nil {
+		t.Errorf("Failed to open database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db}
+	dbHandler.SetStartupGrace(time.Now().Add(time.Minute))
+
+	if result := dbHandler.GetStatus(); result.Status != NotReady || result.Reason != ReasonStarting {
+		t.Errorf("Expected NotReady with reason %q during startup grace but received status %v with reason %q.",
+			ReasonStarting, result.Status, result.Reason)
+	}
+
+	dbHandler.startupGraceUntil = time.Now().Add(-time.Minute)
+
+	if result := dbHandler.GetStatus(); result.Status != Unavailable {
+		t.Errorf("Expected Unavailable after startup grace but received status %v.", result.Status)
+	}
+}
+
+func TestStartupGracePeriodConfig(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %v", err)
+	}
+
+	config := CreateConfig("")
+	config.Set("options.startup_grace_period", "1m")
+
+	dbHandler := CreateDBHandler(config, db)
+	until := dbHandler.startupGraceUntil
+
+	if remaining := time.Until(until); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("Expected the startup grace to end within a minute but it ends in %s.", remaining)
+	}
+
+	// Without -startup, the grace period of the config is kept.
+	dbHandler.SetStartupGrace(time.Time{})
+
+	if !dbHandler.startupGraceUntil.Equal(until) {
+		t.Errorf("Expected the startup grace to end at %s but it ends at %s.", until, dbHandler.startupGraceUntil)
+	}
+
+	later := time.Now().Add(time.Hour)
+	dbHandler.SetStartupGrace(later)
+
+	if !dbHandler.startupGraceUntil.Equal(later) {
+		t.Errorf("Expected the longer startup grace to end at %s but it ends at %s.", later,
+			dbHandler.startupGraceUntil)
+	}
+}
+
+func TestGetClusterInfo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPrepare(wsrepStatusQuery)
+	mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).
+		AddRow("wsrep_cluster_size", "3").
+		AddRow("wsrep_cluster_status", "Primary").
+		AddRow("wsrep_local_index", "1").
+		AddRow("wsrep_cluster_state_uuid", "e2c9a15e-5485-11ea-8a8b-0e9a4c1e2f4b"))
+
+	dbHandler := &DBHandler{db: db}
+
+	expected := ClusterInfo{
+		Size:       3,
+		Status:     "Primary",
+		LocalIndex: 1,
+		StateUUID:  "e2c9a15e-5485-11ea-8a8b-0e9a4c1e2f4b",
+	}
+
+	// The second call must be served from the cache without another query.
+	for i := 0; i < 2; i++ {
+		clusterInfo, err := dbHandler.GetClusterInfo(context.Background())
+		if err != nil {
+			t.Errorf("Expected cluster info but received error: %v", err)
+		} else if *clusterInfo != expected {
+			t.Errorf("Expected cluster info %+v but received %+v.", expected, *clusterInfo)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected queries reading cluster info: %v", err)
+	}
+}
+
+func TestCheckClone(t *testing.T) {
+	tests := []struct {
+		rows     *sqlmock.Rows
+		err      error
+		expected CheckResult
+		ok       bool
+	}{
+		{sqlmock.NewRows([]string{"STATE"}).AddRow("Completed"), nil, CheckResult{}, true},
+		{sqlmock.NewRows([]string{"STATE"}).AddRow("In Progress"), nil,
+			CheckResult{Status: NotReady, Reason: ReasonCloneInProgress}, false},
+		{sqlmock.NewRows([]string{"STATE"}).AddRow("Failed"), nil,
+			CheckResult{Status: Unavailable, Reason: ReasonCloneFailed}, false},
+		{sqlmock.NewRows([]string{"STATE"}), nil, CheckResult{}, true},
+		{nil, &mysql.MySQLError{Number: errNoSuchTable, Message: "Table 'performance_schema.clone_status' doesn't exist"},
+			CheckResult{}, true},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(cloneStatusQuery)
+
+		query := mock.ExpectQuery(cloneStatusQuery)
+		if test.err != nil {
+			query.WillReturnError(test.err)
+		} else {
+			query.WillReturnRows(test.rows)
+		}
+
+		dbHandler := &DBHandler{db: db, checkCloneStatus: true}
+
+		if result, ok := dbHandler.checkClone(context.Background()); result != test.expected || ok != test.ok {
+			t.Errorf("Expected %+v (clear: %t) but received %+v (clear: %t).", test.expected, test.ok, result, ok)
+		}
+	}
+}
+
+func TestCheckEviction(t *testing.T) {
+	tests := []struct {
+		evictList string
+		ok        bool
+	}{
+		{"", true},
+		{"0b2ee9b6-1c1d-11ee-a0a3-4b8e6b6f1b1c", true},
+		{"0b2ee9b6-1c1d-11ee-a0a3-4b8e6b6f1b1c,6f4c1e2a-1c1d-11ee-9c3b-2f9d3e7a8b4d", false},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(wsrepStatusQuery)
+		mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).
+			AddRow("wsrep_gcomm_uuid", "6f4c1e2a-1c1d-11ee-9c3b-2f9d3e7a8b4d").
+			AddRow("wsrep_evs_evict_list", test.evictList))
+
+		dbHandler := &DBHandler{db: db, detectEviction: true}
+
+		result, ok := dbHandler.checkEviction(context.Background())
+		if ok != test.ok {
+			t.Errorf("Expected eviction check to return %t for evict list \"%s\" but received %t.", test.ok, test.evictList, ok)
+		}
+
+		if !ok && (result.Status != Evicted || result.Reason != ReasonEvicted) {
+			t.Errorf("Expected Evicted with reason %q but received status %v with reason %q.",
+				ReasonEvicted, result.Status, result.Reason)
+		}
+	}
+}
+
+func TestBuildDSNConnectionAttributes(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("connection.attributes", map[string]string{
+		"purpose":   "healthcheck",
+		"owner":     "dba-team",
+		"_reserved": "skipped",
+		"invalid":   "a,b",
+	})
+
+	dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, config))
+	if err != nil {
+		t.Errorf("Failed to parse DSN from BuildDSN(): %v", err)
+	}
+
+	expected := "owner:dba-team,purpose:healthcheck"
+	if dsnConfig.ConnectionAttributes != expected {
+		t.Errorf("Expected connection attributes \"%s\" but received \"%s\".", expected, dsnConfig.ConnectionAttributes)
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	tests := []struct {
+		offset          time.Duration
+		failOnClockSkew bool
+		expected        ServerStatus
+	}{
+		{0, true, Available},
+		{time.Minute, false, Available},
+		{time.Minute, true, NotReady},
+		{-time.Minute, true, NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		serverTime := float64(time.Now().Add(test.offset).UnixNano()) / float64(time.Second)
+
+		mock.ExpectPrepare(serverTimeQuery)
+		mock.ExpectQuery(serverTimeQuery).WillReturnRows(sqlmock.NewRows([]string{"now"}).AddRow(serverTime))
+
+		dbHandler := &DBHandler{
+			db:              db,
+			maxClockSkew:    5 * time.Second,
+			failOnClockSkew: test.failOnClockSkew,
+		}
+
+		if result := dbHandler.checkClockSkew(context.Background(), CheckResult{Status: Available}); result.Status != test.expected {
+			t.Errorf("Expected status %v with clock offset %s but received %v.", test.expected, test.offset, result.Status)
+		}
+	}
+}
+
+func TestBuildDSNParseTime(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("connection.parse_time", true)
+	config.Set("connection.loc", "Europe/Paris")
+
+	dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, config))
+	if err != nil {
+		t.Errorf("Failed to parse DSN from BuildDSN(): %v", err)
+	}
+
+	if !dsnConfig.ParseTime {
+		t.Error("Expected parseTime to be enabled in the DSN.")
+	}
+
+	if dsnConfig.Loc.String() != "Europe/Paris" {
+		t.Errorf("Expected loc \"Europe/Paris\" in the DSN but received \"%s\".", dsnConfig.Loc)
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"SELECT status FROM health;", 0},
+		{"SELECT status FROM health WHERE host = ? AND port = ?;", 2},
+		{"SELECT status FROM health WHERE host = '?' AND port = ?;", 1},
+		{`SELECT status FROM health WHERE host = 'it''s?' AND name = "a\"?" AND port = ?;`, 1},
+		{"SELECT `col?` FROM health WHERE host = ?;", 1},
+		{"SELECT status FROM health /* host = ? */ WHERE port = ?; -- or ?", 1},
+		{"SELECT status FROM health # host = ?\nWHERE port = ?;", 1},
+	}
+
+	for _, test := range tests {
+		if count := countPlaceholders(test.query); count != test.expected {
+			t.Errorf("Expected %d placeholders in %q but counted %d.", test.expected, test.query, count)
+		}
+	}
+}
+
+func TestCustomQueryArgs(t *testing.T) {
+	customQuery := "SELECT status FROM health WHERE host = ?;"
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPrepare(customQuery)
+	mock.ExpectQuery(customQuery).WithArgs("database01").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("OK"))
+
+	config := CreateConfig("")
+	config.Set("customQuery", customQuery)
+	config.Set("customResult", "OK")
+	config.Set("customQueryArgs", []string{"database01"})
+
+	dbHandler, err := NewDBHandler(config, db)
+	if err != nil {
+		t.Fatalf("Failed to create DBHandler: %v", err)
+	}
+
+	expected := CheckResult{Status: Available}
+	if result := dbHandler.getCustomRequest(context.Background()); result != expected {
+		t.Errorf("Expected %+v but received %+v.", expected, result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	config.Set("customQueryArgs", []string{"database01", "3306"})
+
+	if _, err := NewDBHandler(config, db); err == nil {
+		t.Error("Expected an error for more customQueryArgs than placeholders.")
+	}
+}
+
+func TestBuildDSNParams(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("connection.user", "healthcheck")
+	config.Set("connection.password", "pa?ss")
+	config.Set("connection.params", map[string]string{
+		"charset":           "utf8mb4",
+		"timeout":           "5s",
+		"interpolateParams": "true",
+		"tls":               "false",
+		"sql_mode":          "'TRADITIONAL'",
+	})
+
+	dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, config))
+	if err != nil {
+		t.Fatalf("Failed to parse DSN from BuildDSN(): %v", err)
+	}
+
+	if dsnConfig.Timeout != 5*time.Second {
+		t.Errorf("Expected connection.params to override the timeout but received %s.", dsnConfig.Timeout)
+	}
+
+	if !dsnConfig.InterpolateParams {
+		t.Error("Expected the interpolateParams driver parameter to be set despite its lowercased key.")
+	}
+
+	if dsnConfig.TLSConfig != "" {
+		t.Errorf("Expected the managed tls parameter to be skipped but received %q.", dsnConfig.TLSConfig)
+	}
+
+	if dsnConfig.Passwd != "pa?ss" {
+		t.Errorf("Expected the password to be kept but received %q.", dsnConfig.Passwd)
+	}
+
+	expected := map[string]string{"charset": "utf8mb4", "sql_mode": "'TRADITIONAL'"}
+	if !reflect.DeepEqual(dsnConfig.Params, expected) {
+		t.Errorf("Expected params %v but received %v.", expected, dsnConfig.Params)
+	}
+
+	config.Set("connection.params", map[string]string{"timeout": "soon"})
+
+	if dsn, err := BuildDSN(config); err == nil {
+		t.Errorf("Expected an error for an invalid driver parameter but received DSN %s.", dsn)
+	}
+}
+
+func TestBuildDSNInterpolateParams(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("connection.interpolate_params", true)
+
+	dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, config))
+	if err != nil {
+		t.Errorf("Failed to parse DSN from BuildDSN(): %v", err)
+	}
+
+	if !dsnConfig.InterpolateParams {
+		t.Error("Expected interpolateParams to be enabled in the DSN.")
+	}
+}
+
+func TestCustomResultRowModes(t *testing.T) {
+	customQuery := "SELECT status FROM health;"
+
+	tests := []struct {
+		rowMode  string
+		values   []string
+		expected ServerStatus
+	}{
+		{rowModeFirstRow, []string{"OK", "FAIL"}, Available},
+		{rowModeFirstRow, []string{"FAIL", "OK"}, NotReady},
+		{rowModeAllMatch, []string{"OK", "OK"}, Available},
+		{rowModeAllMatch, []string{"OK", "FAIL"}, NotReady},
+		{rowModeAnyMatch, []string{"FAIL", "OK"}, Available},
+		{rowModeAnyMatch, []string{"FAIL", "FAIL"}, NotReady},
+		{rowModeAnyMatch, []string{}, NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		rows := sqlmock.NewRows([]string{"status"})
+		for _, value := range test.values {
+			rows.AddRow(value)
+		}
+
+		mock.ExpectPrepare(customQuery)
+		mock.ExpectQuery(customQuery).WillReturnRows(rows).RowsWillBeClosed()
+
+		dbHandler := &DBHandler{db: db, customQuery: customQuery, customResult: "OK", customResultRowMode: test.rowMode}
+
+		if result := dbHandler.getCustomRequest(context.Background()); result.Status != test.expected {
+			t.Errorf("Expected status %v for rows %v in %s mode but received %v.",
+				test.expected, test.values, test.rowMode, result.Status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Expected custom query rows to be closed: %v", err)
+		}
+	}
+}
+
+func TestCustomResultWhitespace(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("customQuery", "SELECT status FROM health;")
+
+	tests := []struct {
+		configured string
+		values     []string
+		expected   ServerStatus
+	}{
+		{" OK\n", []string{"OK"}, Available},
+		{"OK", []string{"OK "}, Available},
+		{"OK", []string{"FAIL"}, NotReady},
+		{"  ", []string{"anything"}, Available},
+		{"", []string{""}, Available},
+		{"", []string{}, NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		config.Set("customResult", test.configured)
+		dbHandler := CreateDBHandler(config, db)
+
+		rows := sqlmock.NewRows([]string{"status"})
+		for _, value := range test.values {
+			rows.AddRow(value)
+		}
+
+		mock.ExpectPrepare(dbHandler.customQuery)
+		mock.ExpectQuery(dbHandler.customQuery).WillReturnRows(rows).RowsWillBeClosed()
+
+		if result := dbHandler.getCustomRequest(context.Background()); result.Status != test.expected {
+			t.Errorf("Expected status %v for rows %q with customResult %q but received %v.",
+				test.expected, test.values, test.configured, result.Status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCheckCommitProgress(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db, commitProgressWindow: time.Minute}
+
+	tests := []struct {
+		lastCommitted string
+		recvQueue     string
+		elapsed       time.Duration
+		expected      ServerStatus
+	}{
+		{"100", "5", 0, Available},
+		{"100", "5", 30 * time.Second, Available},
+		{"100", "5", 2 * time.Minute, NotReady},
+		{"101", "5", 2 * time.Minute, Available},
+		{"101", "0", 2 * time.Minute, Available},
+		{"101", "3", 30 * time.Second, Available},
+	}
+
+	for _, test := range tests {
+		dbHandler.lastCommittedAt = dbHandler.lastCommittedAt.Add(-test.elapsed)
+
+		mock.ExpectPrepare(wsrepStatusQuery)
+		mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+			AddRow("wsrep_last_committed", test.lastCommitted).
+			AddRow("wsrep_local_recv_queue", test.recvQueue))
+
+		if result := dbHandler.checkCommitProgress(context.Background(), CheckResult{Status: Available}); result.Status != test.expected {
+			t.Errorf("Expected status %v for last committed %s after %s but received %v.",
+				test.expected, test.lastCommitted, test.elapsed, result.Status)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db, circuitBreakerThreshold: 2, circuitBreakerCooldown: time.Minute}
+
+	for i := 1; i <= 2; i++ {
+		mock.ExpectPing().WillReturnError(context.DeadlineExceeded)
+
+		if result := dbHandler.GetStatus(); result != (CheckResult{Status: Unavailable}) {
+			t.Errorf("Expected a checked Unavailable result on failure %d but received %v.", i, result)
+		}
+	}
+
+	// The database server must not be queried while the circuit is open.
+	if result := dbHandler.GetStatus(); result != (CheckResult{Status: Unavailable, Reason: ReasonCircuitOpen}) {
+		t.Errorf("Expected the circuit to be open but received %v.", result)
+	}
+
+	dbHandler.circuitOpenUntil = time.Now()
+
+	mock.ExpectPing().WillReturnError(context.DeadlineExceeded)
+
+	if result := dbHandler.GetStatus(); result != (CheckResult{Status: Unavailable}) {
+		t.Errorf("Expected a checked Unavailable result after the cooldown but received %v.", result)
+	}
+
+	if result := dbHandler.GetStatus(); result.Reason != ReasonCircuitOpen {
+		t.Errorf("Expected the circuit to open again after a failed probe but received %v.", result)
+	}
+
+	dbHandler.circuitOpenUntil = time.Now()
+
+	expectSyncedRW(mock)
+
+	if result := dbHandler.GetStatus(); result.Status != Available {
+		t.Errorf("Expected Available after the database recovered but received %v.", result)
+	}
+
+	if dbHandler.unavailableStreak != 0 {
+		t.Errorf("Expected the unavailable streak to be reset but it is %d.", dbHandler.unavailableStreak)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+// newTLSTestClient starts a TLS server and returns an HTTP client which opens a new
+// connection per request using buildTLSConfig, so handshakes can be counted.
+func newTLSTestClient(tb testing.TB, sessionResumption bool) (*httptest.Server, *http.Client) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	tb.Cleanup(server.Close)
+
+	caPath := filepath.Join(tb.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(caPath, caPEM, 0o600); err != nil {
+		tb.Fatalf("Failed to write CA certificate: %v", err)
+	}
+
+	config := CreateConfig("")
+	config.Set("connection.tls.ca", caPath)
+	config.Set("connection.tls.session_resumption", sessionResumption)
+
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		tb.Fatalf("Failed to build TLS config: %v", err)
+	}
+
+	tlsConfig.ServerName = "example.com"
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+
+	return server, client
+}
+
+// getTLSState makes a request on a new connection and returns its TLS state.
+func getTLSState(tb testing.TB, server *httptest.Server, client *http.Client) *tls.ConnectionState {
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		tb.Fatalf("Request to TLS server failed: %v", err)
+	}
+
+	resp.Body.Close()
+
+	return resp.TLS
+}
+
+func TestTLSSessionResumption(t *testing.T) {
+	for _, sessionResumption := range []bool{true, false} {
+		server, client := newTLSTestClient(t, sessionResumption)
+
+		if state := getTLSState(t, server, client); state.DidResume {
+			t.Errorf("Expected a full handshake on the first connection.")
+		}
+
+		if state := getTLSState(t, server, client); state.DidResume != sessionResumption {
+			t.Errorf("Expected session resumption %v on the second connection but received %v.",
+				sessionResumption, state.DidResume)
+		}
+	}
+}
+
+func benchmarkTLSHandshake(b *testing.B, sessionResumption bool) {
+	server, client := newTLSTestClient(b, sessionResumption)
+
+	var fullHandshakes int
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if !getTLSState(b, server, client).DidResume {
+			fullHandshakes++
+		}
+	}
+
+	b.ReportMetric(float64(fullHandshakes)/float64(b.N), "full-handshakes/op")
+}
+
+func BenchmarkTLSFullHandshake(b *testing.B) {
+	benchmarkTLSHandshake(b, false)
+}
+
+func BenchmarkTLSSessionResumption(b *testing.B) {
+	benchmarkTLSHandshake(b, true)
+}
+
+func TestCheckDiskFull(t *testing.T) {
+	tests := []struct {
+		rows     *sqlmock.Rows
+		err      error
+		expected CheckResult
+	}{
+		{sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0), nil, CheckResult{Status: ReadOnly}},
+		{sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2), nil, CheckResult{Status: ReadOnly, Reason: ReasonDiskFull}},
+		{nil, &mysql.MySQLError{Number: errNoSuchTable, Message: "Table 'performance_schema.error_log' doesn't exist"},
+			CheckResult{Status: ReadOnly}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(diskFullQuery)
+
+		query := mock.ExpectQuery(diskFullQuery)
+		if test.err != nil {
+			query.WillReturnError(test.err)
+		} else {
+			query.WillReturnRows(test.rows)
+		}
+
+		dbHandler := &DBHandler{db: db, detectDiskFull: true}
+
+		if result := dbHandler.checkDiskFull(context.Background(), CheckResult{Status: ReadOnly}); result != test.expected {
+			t.Errorf("Expected %+v but received %+v.", test.expected, result)
+		}
+	}
+}
+
+func TestGetClusterHealth(t *testing.T) {
+	tests := []struct {
+		size     string
+		status   string
+		expected bool
+	}{
+		{"3", "Primary", true},
+		{"2", "Primary", false},
+		{"3", "non-Primary", false},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(wsrepStatusQuery)
+		mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).
+			AddRow("wsrep_cluster_size", test.size).
+			AddRow("wsrep_cluster_status", test.status))
+
+		dbHandler := &DBHandler{db: db, clusterMinSize: 3}
+
+		healthy, clusterInfo, err := dbHandler.GetClusterHealth(context.Background())
+		if err != nil {
+			t.Errorf("Expected cluster health but received error: %v", err)
+		} else if healthy != test.expected || clusterInfo.Status != test.status {
+			t.Errorf("Expected healthy %t for %s cluster of %s nodes but received %t.",
+				test.expected, test.status, test.size, healthy)
+		}
+	}
+}
+
+func TestNewDBHandlerValidateOnCreate(t *testing.T) {
+	for _, validateOnCreate := range []bool{false, true} {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		config := CreateConfig("")
+		config.Set("options.validate_on_create", validateOnCreate)
+
+		if validateOnCreate {
+			mock.ExpectPing().WillReturnError(context.DeadlineExceeded)
+		}
+
+		dbHandler, err := NewDBHandler(config, db)
+		if validateOnCreate && (err == nil || dbHandler != nil) {
+			t.Error("Expected an error validating a broken connection on create.")
+		} else if !validateOnCreate && (err != nil || dbHandler == nil) {
+			t.Errorf("Expected a lazily connected DBHandler but received error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCreateDBHandlerPoolSettings(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("connection.conn_max_idle_time", "30s")
+
+	if idleTime := config.GetDuration("connection.pool.conn_max_idle_time"); idleTime != 30*time.Second {
+		t.Errorf("Expected connection.conn_max_idle_time to set the pool idle time but received %s.", idleTime)
+	}
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	CreateDBHandler(config, db)
+
+	// A pinged connection goes back to the pool and must be closed once idle too long.
+	mock.ExpectPing()
+
+	if err := db.Ping(); err != nil {
+		t.Errorf("Failed to ping sqlmock database: %v", err)
+	}
+
+	config.Set("connection.pool.conn_max_idle_time", time.Millisecond)
+	CreateDBHandler(config, db)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for db.Stats().MaxIdleTimeClosed == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if closed := db.Stats().MaxIdleTimeClosed; closed != 1 {
+		t.Errorf("Expected the idle connection to be closed but %d connections were.", closed)
+	}
+}
+
+func TestCheckQuorum(t *testing.T) {
+	tests := []struct {
+		clusterSize  string
+		groupMembers *sqlmock.Rows
+		groupErr     error
+		expected     CheckResult
+	}{
+		{"3", nil, nil, CheckResult{Status: Available}},
+		{"1", nil, nil, CheckResult{Status: NotReady, Reason: ReasonNoQuorum}},
+		{"", sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(3), nil, CheckResult{Status: Available}},
+		{"", sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1), nil, CheckResult{Status: NotReady, Reason: ReasonNoQuorum}},
+		{"", sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0), nil, CheckResult{Status: Available}},
+		{"", nil, &mysql.MySQLError{Number: errNoSuchTable, Message: "Table doesn't exist"}, CheckResult{Status: Available}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		rows := sqlmock.NewRows([]string{"variable", "value"}).AddRow("wsrep_cluster_status", "Primary")
+		if test.clusterSize != "" {
+			rows.AddRow("wsrep_cluster_size", test.clusterSize)
+		}
+
+		mock.ExpectPrepare(wsrepStatusQuery)
+		mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(rows)
+
+		if test.groupMembers != nil || test.groupErr != nil {
+			mock.ExpectPrepare(groupMembersQuery)
+
+			query := mock.ExpectQuery(groupMembersQuery)
+			if test.groupErr != nil {
+				query.WillReturnError(test.groupErr)
+			} else {
+				query.WillReturnRows(test.groupMembers)
+			}
+		}
+
+		dbHandler := &DBHandler{db: db, requireQuorum: true}
+
+		if result := dbHandler.checkQuorum(context.Background(), CheckResult{Status: Available}); result != test.expected {
+			t.Errorf("Expected %+v for cluster size %q but received %+v.", test.expected, test.clusterSize, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestBuildDSNDatabase(t *testing.T) {
+	for _, key := range []string{"dbname", "database"} {
+		path := filepath.Join(t.TempDir(), "healthcheck.yaml")
+		if err := os.WriteFile(path, []byte("connection:\n  "+key+": app\n"), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, CreateConfig(path)))
+		if err != nil {
+			t.Errorf("Failed to parse DSN from BuildDSN(): %v", err)
+		}
+
+		if dsnConfig.DBName != "app" {
+			t.Errorf("Expected database \"app\" in the DSN set by connection.%s but received \"%s\".", key,
+				dsnConfig.DBName)
+		}
+	}
+}
+
+func TestDatabaseMissing(t *testing.T) {
+	expected := CheckResult{Status: NotReady, Reason: ReasonDatabaseMissing}
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing().WillReturnError(&mysql.MySQLError{Number: errBadDB, Message: "Unknown database 'app'"})
+
+	dbHandler := &DBHandler{db: db, dbName: "app"}
+
+	if result := dbHandler.checkStatus(false); result != expected {
+		t.Errorf("Expected %+v when connecting to a missing database but received %+v.", expected, result)
+	}
+
+	mock.ExpectPing()
+	mock.ExpectPrepare(currentDatabaseQuery)
+	mock.ExpectQuery(currentDatabaseQuery).WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow(nil))
+
+	if result := dbHandler.checkStatus(false); result != expected {
+		t.Errorf("Expected %+v when the database was dropped but received %+v.", expected, result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCheckOfflineMode(t *testing.T) {
+	tests := []struct {
+		rows     *sqlmock.Rows
+		err      error
+		expected CheckResult
+		ok       bool
+	}{
+		{sqlmock.NewRows([]string{"@@GLOBAL.offline_mode"}).AddRow(0), nil, CheckResult{}, true},
+		{sqlmock.NewRows([]string{"@@GLOBAL.offline_mode"}).AddRow(1), nil,
+			CheckResult{Status: NotReady, Reason: ReasonOfflineMode}, false},
+		{nil, &mysql.MySQLError{Number: errUnknownSystemVariable, Message: "Unknown system variable 'offline_mode'"},
+			CheckResult{}, true},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(offlineModeQuery)
+
+		query := mock.ExpectQuery(offlineModeQuery)
+		if test.err != nil {
+			query.WillReturnError(test.err)
+		} else {
+			query.WillReturnRows(test.rows)
+		}
+
+		dbHandler := &DBHandler{db: db, honorOfflineMode: true}
+
+		if result, ok := dbHandler.checkOfflineMode(context.Background()); result != test.expected || ok != test.ok {
+			t.Errorf("Expected %+v (in service: %t) but received %+v (in service: %t).", test.expected, test.ok, result, ok)
+		}
+	}
+}
+
+func TestOfflineModeConnectionRefused(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing().WillReturnError(&mysql.MySQLError{Number: errServerOfflineMode, Message: "The server is currently in offline mode"})
+
+	dbHandler := &DBHandler{db: db, honorOfflineMode: true}
+
+	expected := CheckResult{Status: NotReady, Reason: ReasonOfflineMode}
+	if result := dbHandler.checkStatus(false); result != expected {
+		t.Errorf("Expected %+v but received %+v.", expected, result)
+	}
+}
+
+func TestCheckReadWrite(t *testing.T) {
+	writeQuery := "INSERT INTO `healthcheck`.`scratch` () VALUES ();"
+
+	tests := []struct {
+		readErr  error
+		writeErr error
+		expected CheckResult
+	}{
+		{nil, nil, CheckResult{Status: Available}},
+		{errors.New("read timeout"), nil, CheckResult{Status: NotReady, Reason: ReasonReadFailed}},
+		{nil, &mysql.MySQLError{Number: errOptionPreventsStatement, Message: "The MySQL server is running with the --read-only option"},
+			CheckResult{Status: ReadOnly}},
+		{nil, &mysql.MySQLError{Number: errNoSuchTable, Message: "Table 'healthcheck.scratch' doesn't exist"},
+			CheckResult{Status: NotReady, Reason: ReasonWriteFailed}},
+		{nil, &mysql.MySQLError{Number: errTableAccessDenied, Message: "INSERT command denied"},
+			CheckResult{Status: NotReady, Reason: ReasonWriteFailed}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(readProbeQuery)
+
+		if test.readErr != nil {
+			mock.ExpectQuery(readProbeQuery).WillReturnError(test.readErr)
+		} else {
+			mock.ExpectQuery(readProbeQuery).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+			mock.ExpectBegin()
+
+			if test.writeErr != nil {
+				mock.ExpectExec(writeQuery).WillReturnError(test.writeErr)
+			} else {
+				mock.ExpectExec(writeQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			mock.ExpectRollback()
+		}
+
+		dbHandler := &DBHandler{db: db, checkMode: checkModeReadWrite, scratchTable: "healthcheck.scratch",
+			readWriteTimeout: time.Second}
+
+		if result := dbHandler.checkReadWrite(context.Background(), CheckResult{Status: Available}); result != test.expected {
+			t.Errorf("Expected %+v but received %+v.", test.expected, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCheckPrimary(t *testing.T) {
+	tests := []struct {
+		name                  string
+		clusterMode           string
+		availableWhenReadOnly bool
+		status                CheckResult
+		readOnly              string
+		memberRole            string
+		expected              CheckResult
+	}{
+		{"writable node", clusterModeGalera, false, CheckResult{Status: Available}, "", "",
+			CheckResult{Status: Available}},
+		{"read-only node", clusterModeGalera, false, CheckResult{Status: ReadOnly}, "", "",
+			CheckResult{Status: NotReady, Reason: ReasonNotPrimary}},
+		{"read-only node with disk full", clusterModeGalera, false, CheckResult{Status: ReadOnly, Reason: ReasonDiskFull}, "", "",
+			CheckResult{Status: NotReady, Reason: ReasonDiskFull}},
+		{"read-only node tolerated", clusterModeGalera, true, CheckResult{Status: Available}, "ON", "",
+			CheckResult{Status: NotReady, Reason: ReasonNotPrimary}},
+		{"writable node tolerating read-only", clusterModeGalera, true, CheckResult{Status: Available}, "OFF", "",
+			CheckResult{Status: Available}},
+		{"group primary", clusterModeGroupReplication, false, CheckResult{Status: Available}, "", "PRIMARY",
+			CheckResult{Status: Available}},
+		{"group secondary", clusterModeGroupReplication, false, CheckResult{Status: Available}, "", "SECONDARY",
+			CheckResult{Status: NotReady, Reason: ReasonNotPrimary}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		if test.readOnly != "" {
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", test.readOnly))
+		}
+
+		if test.memberRole != "" {
+			mock.ExpectPrepare(groupMemberRoleQuery)
+			mock.ExpectQuery(groupMemberRoleQuery).WillReturnRows(sqlmock.NewRows([]string{"MEMBER_ROLE"}).AddRow(test.memberRole))
+		}
+
+		dbHandler := &DBHandler{db: db, checkMode: checkModePrimaryOnly, clusterMode: test.clusterMode,
+			availableWhenReadOnly: test.availableWhenReadOnly}
+
+		if result := dbHandler.checkPrimary(context.Background(), test.status); result != test.expected {
+			t.Errorf("Expected %+v for %s but received %+v.", test.expected, test.name, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCustomResultMaxLength(t *testing.T) {
+	customQuery := "SELECT status FROM health;"
+
+	tests := []struct {
+		value    string
+		expected CheckResult
+	}{
+		{"OK", CheckResult{Status: Available}},
+		{strings.Repeat("x", 9), CheckResult{Status: NotReady, Reason: ReasonResultTooLarge}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(customQuery)
+		mock.ExpectQuery(customQuery).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(test.value)).
+			RowsWillBeClosed()
+
+		dbHandler := &DBHandler{db: db, customQuery: customQuery, customResult: "OK",
+			customResultRowMode: rowModeFirstRow, customResultMaxLength: 8}
+
+		if result := dbHandler.getCustomRequest(context.Background()); result != test.expected {
+			t.Errorf("Expected %+v for a %d byte result but received %+v.", test.expected, len(test.value), result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestBuildDSNReloadsCA(t *testing.T) {
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+
+	config := CreateConfig("")
+	config.Set("connection.tls.ca", caPath)
+
+	verify := func(cert *x509.Certificate) error {
+		dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, config))
+		if err != nil {
+			t.Fatalf("Failed to parse DSN from BuildDSN(): %v", err)
+		}
+
+		_, err = cert.Verify(x509.VerifyOptions{Roots: dsnConfig.TLS.RootCAs})
+
+		return err
+	}
+
+	var certs []*x509.Certificate
+
+	for i := 0; i < 2; i++ {
+		data, err := os.ReadFile(writeClientCert(t, time.Now().Add(time.Hour)))
+		if err != nil {
+			t.Fatalf("Failed to read CA: %v", err)
+		}
+
+		if err := os.WriteFile(caPath, data, 0o600); err != nil {
+			t.Fatalf("Failed to write CA: %v", err)
+		}
+
+		block, _ := pem.Decode(data)
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("Failed to parse CA: %v", err)
+		}
+
+		certs = append(certs, cert)
+
+		if err := verify(cert); err != nil {
+			t.Errorf("Expected CA %d to be trusted after reload: %v", i+1, err)
+		}
+	}
+
+	if err := verify(certs[0]); err == nil {
+		t.Error("Expected the replaced CA not to be trusted after reload.")
+	}
+
+	if err := os.Remove(caPath); err != nil {
+		t.Fatalf("Failed to remove CA: %v", err)
+	}
+
+	if err := verify(certs[1]); err != nil {
+		t.Errorf("Expected the previous CA to be kept when the CA cannot be loaded: %v", err)
+	}
+}
+
+func TestBuildDSNTLSErrors(t *testing.T) {
+	malformedPath := filepath.Join(t.TempDir(), "malformed.pem")
+	if err := os.WriteFile(malformedPath, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		caPath string
+	}{
+		{"missing CA", filepath.Join(t.TempDir(), "missing.pem")},
+		{"malformed PEM", malformedPath},
+	}
+
+	// Without a previously loaded TLS config, there is nothing to fall back to.
+	registered := customTLSRegistered
+	customTLSRegistered = false
+
+	defer func() { customTLSRegistered = registered }()
+
+	for _, test := range tests {
+		config := CreateConfig("")
+		config.Set("connection.tls.ca", test.caPath)
+
+		if dsn, err := BuildDSN(config); err == nil {
+			t.Errorf("Expected an error with a %s but received DSN %s.", test.name, dsn)
+		}
+
+		if _, err := BuildPortDSN(config, 3307); err == nil {
+			t.Errorf("Expected an error building the port DSN with a %s.", test.name)
+		}
+	}
+}
+
+func TestCreateDBHandlerPoolSizes(t *testing.T) {
+	tests := []struct {
+		maxOpenConns int
+		maxIdleConns int
+		expectedIdle int
+	}{
+		{1, 0, 0},
+		{3, 1, 1},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig("")
+		config.Set("connection.pool.max_open_conns", test.maxOpenConns)
+		config.Set("connection.pool.max_idle_conns", test.maxIdleConns)
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		CreateDBHandler(config, db)
+
+		if maxOpen := db.Stats().MaxOpenConnections; maxOpen != test.maxOpenConns {
+			t.Errorf("Expected %d maximum open connections but received %d.", test.maxOpenConns, maxOpen)
+		}
+
+		// sqlmock opens a connection up front, which is only kept if idle connections are.
+		if idle := db.Stats().Idle; idle != test.expectedIdle {
+			t.Errorf("Expected %d idle connections with max_idle_conns %d but received %d.",
+				test.expectedIdle, test.maxIdleConns, idle)
+		}
+	}
+}
+
+func TestGetReplicationLag(t *testing.T) {
+	columns := []string{"Slave_IO_State", "Master_Host", "Seconds_Behind_Master"}
+
+	tests := []struct {
+		rows     *sqlmock.Rows
+		expected CheckResult
+	}{
+		{sqlmock.NewRows(columns).AddRow("Waiting for source to send event", "db01", 5), CheckResult{Status: Available}},
+		{sqlmock.NewRows(columns).AddRow("Waiting for source to send event", "db01", 30),
+			CheckResult{Status: NotReady, Reason: ReasonReplicationLag}},
+		{sqlmock.NewRows(columns).AddRow("", "db01", nil), CheckResult{Status: NotReady, Reason: ReasonReplicationStopped}},
+		{sqlmock.NewRows(columns), CheckResult{Status: Available}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(slaveStatusQuery)
+		mock.ExpectQuery(slaveStatusQuery).WillReturnRows(test.rows)
+
+		dbHandler := &DBHandler{db: db, maxReplicationLag: 10}
+
+		if result := dbHandler.checkReplicationLag(context.Background(), CheckResult{Status: Available}); result != test.expected {
+			t.Errorf("Expected %+v but received %+v.", test.expected, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCheckSeqnoGap(t *testing.T) {
+	tests := []struct {
+		recvQueue string
+		expected  CheckResult
+	}{
+		{"0", CheckResult{Status: Available}},
+		{"10", CheckResult{Status: Available}},
+		{"11", CheckResult{Status: Lagging, Reason: ReasonSeqnoGap}},
+		{"", CheckResult{Status: Available}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		rows := sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("wsrep_last_committed", "100")
+		if test.recvQueue != "" {
+			rows.AddRow("wsrep_local_recv_queue", test.recvQueue)
+		}
+
+		mock.ExpectPrepare(wsrepStatusQuery)
+		mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(rows)
+
+		dbHandler := &DBHandler{db: db, maxSeqnoGap: 10}
+
+		if result := dbHandler.checkSeqnoGap(context.Background(), CheckResult{Status: Available}); result != test.expected {
+			t.Errorf("Expected %+v for receive queue %q but received %+v.", test.expected, test.recvQueue, result)
+		}
+	}
+}
+
+func TestResolvePassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	t.Setenv("HEALTHCHECK_TEST_PASSWORD", "from-env")
+
+	tests := []struct {
+		password     string
+		passwordFile string
+		expected     string
+	}{
+		{"literal", "", "literal"},
+		{"literal", passwordFile, "literal"},
+		{"", passwordFile, "from-file"},
+		{"${HEALTHCHECK_TEST_PASSWORD}", passwordFile, "from-file"},
+		{"${HEALTHCHECK_TEST_PASSWORD}", "", "from-env"},
+		{"not-${env}", "", "not-${env}"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		if test.password != "" {
+			config.Set("connection.password", test.password)
+		}
+
+		if test.passwordFile != "" {
+			config.Set("connection.password_file", test.passwordFile)
+		}
+
+		password, err := resolvePassword(config)
+		if err != nil {
+			t.Errorf("Failed to resolve password: %v", err)
+		}
+
+		if password != test.expected {
+			t.Errorf("Expected password %q for password %q and file %q but received %q.",
+				test.expected, test.password, test.passwordFile, password)
+		}
+	}
+
+	config := viper.New()
+	config.Set("connection.password_file", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := resolvePassword(config); err == nil {
+		t.Error("Expected an error for a missing password file.")
+	}
+}
+
+func TestBuildDSNRedactsResolvedPassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	config := CreateConfig("")
+	config.Set("connection.user", "healthcheck")
+	config.Set("connection.password_file", passwordFile)
+
+	hook := logrustest.NewGlobal()
+	defer hook.Reset()
+
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.DebugLevel)
+
+	defer logrus.SetLevel(level)
+
+	dsnConfig, err := mysql.ParseDSN(mustBuildDSN(t, config))
+	if err != nil {
+		t.Errorf("Failed to parse DSN from BuildDSN(): %v", err)
+	}
+
+	if dsnConfig.Passwd != "s3cr3t" {
+		t.Errorf("Expected the password from the file in the DSN but received %q.", dsnConfig.Passwd)
+	}
+
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, "s3cr3t") {
+			t.Errorf("Expected the password to be redacted from the logs but found: %s", entry.Message)
+		}
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	tests := []struct {
+		err      error
+		number   uint16
+		expected string
+	}{
+		{&mysql.MySQLError{Number: 1045, Message: "Access denied for user 'healthcheck'"}, 1045,
+			"Access denied for user 'healthcheck'"},
+		{errors.New("dial tcp: password s3cr3t rejected"), 0, "dial tcp: password <redacted> rejected"},
+		{errors.New(strings.Repeat("x", maxLastErrorLength+1)), 0, strings.Repeat("x", maxLastErrorLength) + "..."},
+	}
+
+	for _, test := range tests {
+		dbHandler := &DBHandler{password: "s3cr3t"}
+		dbHandler.recordError(test.err)
+
+		lastError := dbHandler.LastError()
+		if lastError.Number != test.number || lastError.Message != test.expected {
+			t.Errorf("Expected last error %d %q but received %d %q.", test.number, test.expected,
+				lastError.Number, lastError.Message)
+		}
+	}
+}
+
+func TestBuildPortDSN(t *testing.T) {
+	config := CreateConfig("")
+	config.Set("connection.host", "db1.example.com")
+	config.Set("connection.unix_socket", "/var/run/mysqld/mysqld.sock")
+	config.Set("connection.user", "healthcheck")
+	config.Set("connection.dbname", "app")
+
+	dsn, err := BuildPortDSN(config, 3307)
+	if err != nil {
+		t.Fatalf("BuildPortDSN() failed: %v", err)
+	}
+
+	dsnConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Errorf("Failed to parse DSN from BuildPortDSN(): %v", err)
+	}
+
+	if dsnConfig.Net != "tcp" || dsnConfig.Addr != "db1.example.com:3307" {
+		t.Errorf("Expected tcp(db1.example.com:3307) in the DSN but received %s(%s).", dsnConfig.Net, dsnConfig.Addr)
+	}
+
+	if dsnConfig.User != "healthcheck" || dsnConfig.DBName != "app" {
+		t.Errorf("Expected the shared connection config in the DSN but received user %q and database %q.",
+			dsnConfig.User, dsnConfig.DBName)
+	}
+}
+
+func TestCustomResultTypedColumns(t *testing.T) {
+	customQuery := "SELECT status FROM health;"
+
+	tests := []struct {
+		name     string
+		result   string
+		rows     *sqlmock.Rows
+		expected ServerStatus
+	}{
+		{"integer", "1", sqlmock.NewRows([]string{"ok"}).AddRow(1), Available},
+		{"wrong integer", "1", sqlmock.NewRows([]string{"ok"}).AddRow(0), NotReady},
+		{"multiple columns", "OK", sqlmock.NewRows([]string{"status", "lag"}).AddRow("OK", 42), Available},
+		{"multiple columns mismatch", "OK", sqlmock.NewRows([]string{"status", "lag"}).AddRow("FAIL", "OK"), NotReady},
+		{"empty", "OK", sqlmock.NewRows([]string{"status"}), NotReady},
+		{"empty with multiple columns", "OK", sqlmock.NewRows([]string{"status", "lag"}), NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(customQuery)
+		mock.ExpectQuery(customQuery).WillReturnRows(test.rows).RowsWillBeClosed()
+
+		dbHandler := &DBHandler{db: db, customQuery: customQuery, customResult: test.result,
+			customResultRowMode: rowModeFirstRow}
+
+		if result := dbHandler.getCustomRequest(context.Background()); result.Status != test.expected {
+			t.Errorf("Expected status %v for %s result but received %v.", test.expected, test.name, result.Status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Expected custom query rows to be closed for %s result: %v", test.name, err)
+		}
+	}
+}
+
+func TestParseWsrepStates(t *testing.T) {
+	tests := []struct {
+		names    []string
+		expected map[WsrepStatus]bool
+	}{
+		{[]string{"synced"}, map[WsrepStatus]bool{Synced: true}},
+		{[]string{"Synced", " joined "}, map[WsrepStatus]bool{Synced: true, Joined: true}},
+		{[]string{"synced", "donr"}, map[WsrepStatus]bool{Synced: true}},
+		{[]string{"donr"}, map[WsrepStatus]bool{Synced: true}},
+		{nil, map[WsrepStatus]bool{Synced: true}},
+	}
+
+	for _, test := range tests {
+		if states := parseWsrepStates(test.names); !reflect.DeepEqual(states, test.expected) {
+			t.Errorf("Expected states %v for %q but received %v.", test.expected, test.names, states)
+		}
+	}
+}
+
+func TestAvailableStates(t *testing.T) {
+	tests := []struct {
+		availableStates []string
+		donor           bool
+		wsrepState      WsrepStatus
+		expected        ServerStatus
+	}{
+		{[]string{"synced"}, false, Joined, NotReady},
+		{[]string{"synced", "joined"}, false, Joined, Available},
+		{[]string{"synced", "joined"}, false, Donor, NotReady},
+		{[]string{"synced"}, true, Donor, Available},
+		{[]string{"joined"}, false, Synced, NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		config := CreateConfig("")
+		config.Set("options.available_states", test.availableStates)
+		config.Set("options.available_when_donor", test.donor)
+
+		dbHandler := CreateDBHandler(config, db)
+
+		mock.ExpectPing()
+		mock.ExpectPrepare(wsrepLocalStateQuery)
+		mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", test.wsrepState))
+
+		if test.expected == Available {
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+			mock.ExpectPrepare(wsrepStatusQuery)
+			mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(getMockRow("wsrep_cluster_status", clusterPrimary))
+		}
+
+		if status := dbHandler.GetStatus().Status; status != test.expected {
+			t.Errorf("Expected status %v for wsrep state %v with available states %q but received %v.",
+				test.expected, test.wsrepState, test.availableStates, status)
+		}
+	}
+}
+
+func TestCheckSST(t *testing.T) {
+	tests := []struct {
+		comment  string
+		expected CheckResult
+	}{
+		{"Joining: receiving State Transfer", CheckResult{Status: NotReady, Reason: ReasonReceivingSST}},
+		{"Joining: waiting for State Transfer", CheckResult{Status: NotReady}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing()
+		mock.ExpectPrepare(wsrepLocalStateQuery)
+		mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Joining))
+		mock.ExpectPrepare(wsrepStateCommentQuery)
+		mock.ExpectQuery(wsrepStateCommentQuery).
+			WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+				AddRow("wsrep_local_state_comment", test.comment))
+
+		dbHandler := &DBHandler{db: db, detectSST: true}
+
+		if result := dbHandler.GetStatus(); result != test.expected {
+			t.Errorf("Expected %+v for %q but received %+v.", test.expected, test.comment, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		expect   func(mock sqlmock.Sqlmock)
+		setup    func(dbHandler *DBHandler)
+		expected ServerStatus
+	}{
+		{"ping", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing().WillDelayFor(time.Second)
+		}, nil, Unavailable},
+		{"wsrep_local_state", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing()
+			mock.ExpectPrepare(wsrepLocalStateQuery)
+			mock.ExpectQuery(wsrepLocalStateQuery).WillDelayFor(time.Second).
+				WillReturnRows(getMockRow("wsrep_local_state", Synced))
+		}, nil, Unavailable},
+		{"read_only", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing()
+			mock.ExpectPrepare(wsrepLocalStateQuery)
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillDelayFor(time.Second).WillReturnRows(getMockRow("read_only", "OFF"))
+		}, nil, Unavailable},
+		{"custom query", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing()
+			mock.ExpectPrepare("SELECT status FROM health;")
+			mock.ExpectQuery("SELECT status FROM health;").WillDelayFor(time.Second).
+				WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("OK"))
+		}, func(dbHandler *DBHandler) {
+			dbHandler.customQuery, dbHandler.customResult = "SELECT status FROM health;", "OK"
+		}, Unavailable},
+		{"offline_mode", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing()
+			mock.ExpectPrepare(offlineModeQuery)
+			mock.ExpectQuery(offlineModeQuery).WillDelayFor(time.Second).
+				WillReturnRows(sqlmock.NewRows([]string{"@@GLOBAL.offline_mode"}).AddRow(0))
+		}, func(dbHandler *DBHandler) {
+			dbHandler.honorOfflineMode = true
+		}, Unavailable},
+		{"quorum", func(mock sqlmock.Sqlmock) {
+			expectSyncedRW(mock)
+			mock.ExpectPrepare(wsrepStatusQuery)
+			mock.ExpectQuery(wsrepStatusQuery).WillDelayFor(time.Second).
+				WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).AddRow("wsrep_cluster_size", "1"))
+		}, func(dbHandler *DBHandler) {
+			dbHandler.requireQuorum = true
+		}, Unavailable},
+		{"clone_status", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing()
+			mock.ExpectPrepare(cloneStatusQuery)
+			mock.ExpectQuery(cloneStatusQuery).WillDelayFor(time.Second).
+				WillReturnRows(sqlmock.NewRows([]string{"STATE"}).AddRow("Completed"))
+		}, func(dbHandler *DBHandler) {
+			dbHandler.checkCloneStatus = true
+		}, Unavailable},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		test.expect(mock)
+
+		dbHandler := &DBHandler{db: db, checkTimeout: 50 * time.Millisecond}
+		if test.setup != nil {
+			test.setup(dbHandler)
+		}
+
+		start := time.Now()
+
+		if result := dbHandler.GetStatus(); result.Status != test.expected {
+			t.Errorf("Expected status %v after a %s timeout but received %v.", test.expected, test.name, result.Status)
+		}
+
+		if elapsed := time.Since(start); elapsed >= time.Second {
+			t.Errorf("Expected the %s check to be cancelled by the timeout but it took %s.", test.name, elapsed)
+		}
+	}
+}
+
+func TestCheckGroupReplication(t *testing.T) {
+	tests := []struct {
+		memberState string
+		readOnly    string
+		expected    ServerStatus
+	}{
+		{"ONLINE", "OFF", Available},
+		{"ONLINE", "ON", ReadOnly},
+		{"RECOVERING", "", NotReady},
+		{"ERROR", "", NotReady},
+		{"", "", NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		rows := sqlmock.NewRows([]string{"MEMBER_STATE"})
+		if test.memberState != "" {
+			rows.AddRow(test.memberState)
+		}
+
+		mock.ExpectPing()
+		mock.ExpectPrepare(groupMemberStateQuery)
+		mock.ExpectQuery(groupMemberStateQuery).WillReturnRows(rows)
+
+		if test.readOnly != "" {
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", test.readOnly))
+		}
+
+		dbHandler := &DBHandler{db: db, clusterMode: clusterModeGroupReplication}
+
+		if status := dbHandler.GetStatus().Status; status != test.expected {
+			t.Errorf("Expected status %v for member state %q but received %v.", test.expected, test.memberState, status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestGetStrictStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbHandler  *DBHandler
+		wsrepState WsrepStatus
+		readOnly   string
+		expected   ServerStatus
+	}{
+		{"donor", &DBHandler{availableStates: map[WsrepStatus]bool{Synced: true, Donor: true}}, Donor, "", NotReady},
+		{"joined", &DBHandler{availableStates: map[WsrepStatus]bool{Synced: true, Joined: true}}, Joined, "", NotReady},
+		{"read-only", &DBHandler{availableWhenReadOnly: true}, Synced, "ON", ReadOnly},
+		{"synced", &DBHandler{availableWhenReadOnly: true}, Synced, "OFF", Available},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing()
+		mock.ExpectPrepare(wsrepLocalStateQuery)
+		mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", test.wsrepState))
+
+		if test.readOnly != "" {
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", test.readOnly))
+		}
+
+		test.dbHandler.db = db
+
+		if status := test.dbHandler.GetStrictStatus().Status; status != test.expected {
+			t.Errorf("Expected strict status %v for a %s node but received %v.", test.expected, test.name, status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db, cacheTTL: 100 * time.Millisecond}
+
+	// Any check beyond the expected ones fails on an unexpected query.
+	expectSyncedRW(mock)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if status := dbHandler.GetStatus().Status; status != Available {
+				t.Errorf("Expected status Available from the cache but received %v.", status)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	time.Sleep(dbHandler.cacheTTL)
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	if status := dbHandler.GetStatus().Status; status != Unavailable {
+		t.Errorf("Expected status Unavailable once the cache expired but received %v.", status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStandbyRole(t *testing.T) {
+	tests := []struct {
+		pingErr  error
+		expected ServerStatus
+	}{
+		{nil, Standby},
+		{errors.New("connection refused"), Unavailable},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		if test.pingErr != nil {
+			mock.ExpectPing().WillReturnError(test.pingErr)
+		} else {
+			mock.ExpectPing()
+			mock.ExpectPrepare(wsrepLocalStateQuery)
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+		}
+
+		dbHandler := &DBHandler{db: db, standby: true}
+
+		if status := dbHandler.GetStatus().Status; status != test.expected {
+			t.Errorf("Expected status %v but received %v.", test.expected, status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestUseSingleConnection(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing()
+	mock.ExpectPrepare(wsrepLocalStateQuery)
+	mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+	mock.ExpectPrepare(readOnlyQuery)
+	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+	mock.ExpectPrepare(wsrepStatusQuery)
+	mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(getMockRow("wsrep_cluster_status", clusterPrimary))
+
+	dbHandler := CreateDBHandler(CreateConfig(""), db)
+	dbHandler.UseSingleConnection()
+
+	if status := dbHandler.GetStatus().Status; status != Available {
+		t.Errorf("Expected status %v but received %v.", Available, status)
+	}
+
+	stats := db.Stats()
+	if stats.MaxOpenConnections != 1 || stats.OpenConnections != 1 {
+		t.Errorf("Expected a single connection but received %d open of at most %d.", stats.OpenConnections,
+			stats.MaxOpenConnections)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDescribeConnectionError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{&mysql.MySQLError{Number: errAccessDenied, Message: "Access denied for user 'healthcheck'"}, "authentication failed"},
+		{&mysql.MySQLError{Number: errBadDB, Message: "Unknown database 'app'"}, "connection.dbname does not exist"},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "database01", IsNotFound: true}},
+			`could not resolve "database01"`},
+		{&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, "the server certificate was rejected"},
+		{mysql.ErrNoTLS, "TLS negotiation failed"},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "connection refused"},
+		{context.DeadlineExceeded, "connection timed out"},
+		{errors.New("unexpected"), "unexpected"},
+	}
+
+	for _, test := range tests {
+		if description := describeConnectionError(test.err); !strings.HasPrefix(description, test.expected) {
+			t.Errorf("Expected a description starting with %q for %v but received %q.", test.expected, test.err,
+				description)
+		}
+	}
+}
+
+func TestCheckBinlog(t *testing.T) {
+	tests := []struct {
+		logBin   interface{}
+		err      error
+		expected CheckResult
+	}{
+		{1, nil, CheckResult{Status: Available}},
+		{0, nil, CheckResult{Status: NotReady, Reason: ReasonBinlogDisabled}},
+		{nil, nil, CheckResult{Status: Available}},
+		{nil, &mysql.MySQLError{Number: errUnknownSystemVariable, Message: "Unknown system variable 'log_bin'"},
+			CheckResult{Status: Available}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(logBinQuery)
+
+		if test.err != nil {
+			mock.ExpectQuery(logBinQuery).WillReturnError(test.err)
+		} else {
+			mock.ExpectQuery(logBinQuery).WillReturnRows(sqlmock.NewRows([]string{"@@GLOBAL.log_bin"}).AddRow(test.logBin))
+		}
+
+		dbHandler := &DBHandler{db: db, requireBinlog: true}
+
+		if result := dbHandler.checkBinlog(context.Background(), CheckResult{Status: Available}); result != test.expected {
+			t.Errorf("Expected %+v for log_bin %v but received %+v.", test.expected, test.logBin, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestRequirePrimaryComponent(t *testing.T) {
+	tests := []struct {
+		name          string
+		required      bool
+		clusterStatus string
+		queryErr      error
+		expected      CheckResult
+	}{
+		{"primary and synced", true, clusterPrimary, nil, CheckResult{Status: Available}},
+		{"non-primary and synced", true, "non-Primary", nil,
+			CheckResult{Status: NotReady, Reason: ReasonNonPrimaryComponent}},
+		{"no cluster status", true, "", nil, CheckResult{Status: Available}},
+		{"cluster status unreadable", true, "", errors.New("connection reset"), CheckResult{Status: NotReady}},
+		{"not required", false, "non-Primary", nil, CheckResult{Status: Available}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		config := CreateConfig("")
+		config.Set("options.honor_offline_mode", false)
+		config.Set("options.require_primary_component", test.required)
+
+		dbHandler := CreateDBHandler(config, db)
+
+		expectSyncedRW(mock)
+
+		if test.required {
+			mock.ExpectPrepare(wsrepStatusQuery)
+
+			rows := sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("wsrep_cluster_size", "3")
+			if test.clusterStatus != "" {
+				rows.AddRow("wsrep_cluster_status", test.clusterStatus)
+			}
+
+			if test.queryErr != nil {
+				mock.ExpectQuery(wsrepStatusQuery).WillReturnError(test.queryErr)
+			} else {
+				mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(rows)
+			}
+		}
+
+		if result := dbHandler.GetStatus(); result != test.expected {
+			t.Errorf("Expected %+v with %s but received %+v.", test.expected, test.name, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations with %s: %s", test.name, err)
+		}
+	}
+}
+
+func TestCheckStandalone(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterMode string
+		readOnly    string
+		expected    ServerStatus
+	}{
+		{"standalone cluster mode", clusterModeStandalone, "OFF", Available},
+		{"read-only standalone server", clusterModeStandalone, "ON", ReadOnly},
+		{"galera without wsrep", clusterModeGalera, "OFF", Available},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing()
+
+		if test.clusterMode == clusterModeGalera {
+			mock.ExpectPrepare(wsrepLocalStateQuery)
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}))
+		}
+
+		mock.ExpectPrepare(readProbeQuery)
+		mock.ExpectQuery(readProbeQuery).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+		mock.ExpectPrepare(readOnlyQuery)
+		mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", test.readOnly))
+
+		dbHandler := &DBHandler{db: db, clusterMode: test.clusterMode}
+
+		if status := dbHandler.GetStatus().Status; status != test.expected {
+			t.Errorf("Expected status %v for %s but received %v.", test.expected, test.name, status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations for %s: %s", test.name, err)
+		}
+	}
+}
+
+func TestExcludeColdStartFromMetrics(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	dbHandler := &DBHandler{db: db, latencies: NewLatencyWindow(8), coldStartChecks: 2}
+
+	for i := 1; i <= 3; i++ {
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		if _, coldStart := dbHandler.getStatus(); coldStart != (i <= 2) {
+			t.Errorf("Expected check %d to be a cold-start check: %t, but received %t.", i, i <= 2, coldStart)
+		}
+	}
+
+	if samples := dbHandler.latencies.Quantiles().Samples; samples != 1 {
+		t.Errorf("Expected only the check after the cold start in the latency window but received %d.", samples)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestColdStartNotCached(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	maintenanceFile := filepath.Join(t.TempDir(), "maintenance")
+	dbHandler := &DBHandler{db: db, coldStartChecks: 2, cacheTTL: time.Minute, maintenanceFile: maintenanceFile}
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	if _, coldStart := dbHandler.getStatus(); !coldStart {
+		t.Error("Expected the first check to be a cold-start check.")
+	}
+
+	if _, coldStart := dbHandler.getStatus(); coldStart {
+		t.Error("Expected the cached result not to be tagged as a cold-start check.")
+	}
+
+	if err := os.WriteFile(maintenanceFile, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create maintenance file: %v", err)
+	}
+
+	if _, coldStart := dbHandler.getStatus(); coldStart {
+		t.Error("Expected the maintenance result not to be tagged as a cold-start check.")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := []struct {
+		name     string
+		attempts int
+		expected CheckResult
+	}{
+		{"no retry", 1, CheckResult{Status: Unavailable}},
+		{"retry", 2, CheckResult{Status: Available}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing().WillReturnError(resetErr)
+
+		if test.attempts > 1 {
+			expectSyncedRW(mock)
+		}
+
+		dbHandler := &DBHandler{db: db, retryAttempts: test.attempts, retryDelay: time.Millisecond,
+			checkTimeout: time.Second}
+
+		if result := dbHandler.GetStatus(); result != test.expected {
+			t.Errorf("Expected %+v with %s but received %+v.", test.expected, test.name, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unfulfilled expectations with %s: %v", test.name, err)
+		}
+	}
+}
+
+func TestRetryNotTransient(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing().WillReturnError(&mysql.MySQLError{Number: errAccessDenied, Message: "Access denied"})
+
+	dbHandler := &DBHandler{db: db, retryAttempts: 3, retryDelay: time.Millisecond}
+
+	expected := CheckResult{Status: Unavailable, Reason: ReasonAuth}
+	if result := dbHandler.GetStatus(); result != expected {
+		t.Errorf("Expected %+v but received %+v.", expected, result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCustomQueryRetry(t *testing.T) {
+	const customQuery = "SELECT status FROM health;"
+
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := []struct {
+		name             string
+		disablePrepared  bool
+		failAfterScanned bool
+		expected         CheckResult
+	}{
+		{"prepared statement", false, false, CheckResult{Status: Available}},
+		{"prepared statements disabled", true, false, CheckResult{Status: Available}},
+		{"failure after scanned rows", false, true, CheckResult{Status: NotReady}},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing()
+
+		if !test.disablePrepared {
+			mock.ExpectPrepare(customQuery)
+		}
+
+		if test.failAfterScanned {
+			mock.ExpectQuery(customQuery).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("OK").AddRow("OK").
+				RowError(1, resetErr))
+		} else {
+			mock.ExpectQuery(customQuery).WillReturnError(resetErr)
+
+			if !test.disablePrepared {
+				mock.ExpectPrepare(customQuery)
+			}
+
+			mock.ExpectQuery(customQuery).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("OK"))
+		}
+
+		dbHandler := &DBHandler{db: db, retryAttempts: 2, retryDelay: time.Millisecond, checkTimeout: time.Second,
+			disablePreparedStatements: test.disablePrepared, customQuery: customQuery, customResult: "OK"}
+
+		if result := dbHandler.GetStatus(); result != test.expected {
+			t.Errorf("Expected %+v with %s but received %+v.", test.expected, test.name, result)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unfulfilled expectations with %s: %v", test.name, err)
+		}
+	}
+}
+
+func TestRetryBoundedByContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	dbHandler := &DBHandler{retryAttempts: 100, retryDelay: time.Hour}
+
+	attempts := 0
+	start := time.Now()
+
+	err := dbHandler.retry(ctx, func() error {
+		attempts++
+		return driver.ErrBadConn
+	})
+
+	if !errors.Is(err, driver.ErrBadConn) || attempts != 1 {
+		t.Errorf("Expected a single failed attempt but received %d attempts and %v.", attempts, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected retries to stop with the context but they took %s.", elapsed)
+	}
+}
+
+func TestGetStatusLogsNoInfo(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(mock)
+
+	hook := logrustest.NewGlobal()
+	defer hook.Reset()
+
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.DebugLevel)
+
+	defer logrus.SetLevel(level)
+
+	dbHandler := &DBHandler{db: db}
+
+	if result := dbHandler.GetStatus(); result.Status != Available {
+		t.Errorf("Expected the node to be available but received %+v.", result)
+	}
+
+	for _, entry := range hook.AllEntries() {
+		if entry.Level <= logrus.InfoLevel {
+			t.Errorf("Expected health checks to log at debug level only but received %q at %s level.",
+				entry.Message, entry.Level)
+		}
+	}
+}
+
+func TestCustomQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name               string
+		checkTimeout       time.Duration
+		customQueryTimeout time.Duration
+		expected           ServerStatus
+	}{
+		{"check_timeout only", time.Second, 0, Available},
+		{"custom_query_timeout", time.Second, 20 * time.Millisecond, Unavailable},
+		{"custom_query_timeout within check_timeout", 20 * time.Millisecond, time.Second, Unavailable},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing()
+		mock.ExpectPrepare("SELECT status FROM health;")
+		mock.ExpectQuery("SELECT status FROM health;").WillDelayFor(100 * time.Millisecond).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("OK"))
+
+		dbHandler := &DBHandler{db: db, checkTimeout: test.checkTimeout, customQueryTimeout: test.customQueryTimeout,
+			customQuery: "SELECT status FROM health;", customResult: "OK"}
+
+		if result := dbHandler.GetStatus(); result.Status != test.expected {
+			t.Errorf("Expected status %v with %s but received %v.", test.expected, test.name, result.Status)
+		}
+
+		duration, ok := dbHandler.CustomQueryDuration()
+		if !ok {
+			t.Errorf("Expected the custom query duration to be captured with %s.", test.name)
+		}
+
+		if test.expected == Available && duration < 100*time.Millisecond {
+			t.Errorf("Expected a custom query duration of at least 100ms but received %s.", duration)
+		}
+	}
+}
+
+func TestCustomChecks(t *testing.T) {
+	sentinelQuery := "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = 'sentinel';"
+	flagQuery := "SELECT value FROM flags WHERE name = ?;"
+
+	tests := []struct {
+		name     string
+		checks   []map[string]interface{}
+		expect   func(mock sqlmock.Sqlmock)
+		expected ServerStatus
+	}{
+		{"all pass", []map[string]interface{}{
+			{"query": sentinelQuery, "expected_result": "1"},
+			{"query": flagQuery, "expected_result": "1", "args": []string{"healthy"}},
+		}, func(mock sqlmock.Sqlmock) {
+			mock.ExpectPrepare(sentinelQuery)
+			mock.ExpectQuery(sentinelQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectPrepare(flagQuery)
+			mock.ExpectQuery(flagQuery).WithArgs("healthy").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+		}, Available},
+		{"first fails", []map[string]interface{}{
+			{"query": sentinelQuery, "expected_result": "1"},
+			{"query": flagQuery, "expected_result": "1", "args": []string{"healthy"}},
+		}, func(mock sqlmock.Sqlmock) {
+			// The flag query is never run once the sentinel check failed.
+			mock.ExpectPrepare(sentinelQuery)
+			mock.ExpectQuery(sentinelQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		}, NotReady},
+		{"second fails", []map[string]interface{}{
+			{"query": sentinelQuery, "expected_result": "1"},
+			{"query": flagQuery, "expected_result": "1", "args": []string{"healthy"}},
+		}, func(mock sqlmock.Sqlmock) {
+			mock.ExpectPrepare(sentinelQuery)
+			mock.ExpectQuery(sentinelQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectPrepare(flagQuery)
+			mock.ExpectQuery(flagQuery).WithArgs("healthy").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(0))
+		}, NotReady},
+		{"order is kept", []map[string]interface{}{
+			{"query": flagQuery, "expected_result": "1", "args": []string{"healthy"}},
+			{"query": sentinelQuery, "expected_result": "1"},
+		}, func(mock sqlmock.Sqlmock) {
+			mock.ExpectPrepare(flagQuery)
+			mock.ExpectQuery(flagQuery).WithArgs("healthy").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(0))
+		}, NotReady},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		test.expect(mock)
+
+		config := CreateConfig("")
+		config.Set("options.checks", test.checks)
+
+		dbHandler, err := NewDBHandler(config, db)
+		if err != nil {
+			t.Fatalf("Failed to create DBHandler: %v", err)
+		}
+
+		if result := dbHandler.getCustomRequest(context.Background()); result.Status != test.expected {
+			t.Errorf("Expected %v with %s but received %v.", test.expected, test.name, result.Status)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unfulfilled expectations with %s: %v", test.name, err)
+		}
+	}
+}
+
+func TestCustomChecksShorthand(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %v", err)
+	}
+
+	config := CreateConfig("")
+	config.Set("customQuery", "SELECT 1;")
+	config.Set("customResult", "1")
+
+	dbHandler := CreateDBHandler(config, db)
+
+	expected := []customCheck{{query: "SELECT 1;", expectedResult: "1"}}
+	if checks := dbHandler.customCheckList(); !reflect.DeepEqual(checks, expected) {
+		t.Errorf("Expected %+v but received %+v.", expected, checks)
+	}
+
+	config.Set("options.checks", []map[string]interface{}{{"query": "SELECT 2;", "expected_result": "2"}})
+
+	dbHandler = CreateDBHandler(config, db)
+
+	expected = []customCheck{{query: "SELECT 2;", expectedResult: "2"}}
+	if checks := dbHandler.customCheckList(); !reflect.DeepEqual(checks, expected) {
+		t.Errorf("Expected options.checks to replace customQuery but received %+v.", checks)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Detail.go gathers the complete status of the node in one object, for debugging.
+*/
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// statusDetailTTL is how long the detailed status is cached for, so repeated
+// debugging requests do not add load on the database server.
+const statusDetailTTL = 5 * time.Second
+
+const (
+	// serverVersionQuery returns the version of the database server.
+	serverVersionQuery = "SELECT @@GLOBAL.version;"
+	// superReadOnlyQuery determines if the node is in super_read_only mode, which
+	// MariaDB does not have.
+	superReadOnlyQuery = "SELECT @@GLOBAL.super_read_only;"
+)
+
+// StatusDetail is the complete status of the node, combining the result of a
+// health check with everything known about the server.  Fields which could not be
+// read, or do not apply to the server, are omitted.
+type StatusDetail struct {
+	Status  string `json:"status"`
+	Reason  Reason `json:"reason,omitempty"`
+	Ready   bool   `json:"ready"`
+	Message string `json:"message"`
+	Role    string `json:"role"`
+
+	ServerVersion     string       `json:"server_version,omitempty"`
+	WsrepState        *WsrepStatus `json:"wsrep_state,omitempty"`
+	WsrepStateComment string       `json:"wsrep_state_comment,omitempty"`
+	Cluster           *ClusterInfo `json:"cluster,omitempty"`
+	ReadOnly          *bool        `json:"read_only,omitempty"`
+	SuperReadOnly     *bool        `json:"super_read_only,omitempty"`
+	ReplicationLag    *int         `json:"replication_lag_seconds,omitempty"`
+	LastError         *LastError   `json:"last_error,omitempty"`
+
+	CheckedAt     string  `json:"checked_at"`
+	CheckDuration float64 `json:"check_duration_seconds"`
+}
+
+// GetStatusDetailed runs a health check and gathers the complete status of the
+// node around it.  The result is cached for statusDetailTTL.  Like
+// GetStrictStatus, the check does not go through the circuit breaker, result
+// window or success threshold, nor affect them, so debugging a node does not
+// change how it is routed.
+func (h *DBHandler) GetStatusDetailed() *StatusDetail {
+	h.mu.Lock()
+	if h.detail != nil && time.Since(h.detailAt) < statusDetailTTL {
+		defer h.mu.Unlock()
+		return h.detail
+	}
+	h.mu.Unlock()
+
+	start := time.Now()
+
+	result := CheckResult{Status: Unavailable, Reason: ReasonMaintenance}
+	if !h.inMaintenance() {
+		result = h.applyRole(h.checkStatus(false))
+	}
+
+	detail := &StatusDetail{
+		Status:        result.Status.String(),
+		Reason:        result.Reason,
+		Ready:         result.Status == Available,
+		Message:       statusMessage(result),
+		Role:          rolePrimary,
+		CheckedAt:     start.UTC().Format(time.RFC3339),
+		CheckDuration: time.Since(start).Seconds(),
+	}
+
+	if h.standby {
+		detail.Role = roleStandby
+	}
+
+	if result.Status != Unavailable {
+		h.readServerDetail(detail)
+	}
+
+	detail.LastError = h.LastError()
+
+	h.mu.Lock()
+	h.detail = detail
+	h.detailAt = time.Now()
+	h.mu.Unlock()
+
+	return detail
+}
+
+// readServerDetail fills in the details read from the database server.  Details
+// which cannot be read are left out, so one failing query does not hide the rest.
+func (h *DBHandler) readServerDetail(detail *StatusDetail) {
+	ctx, cancel := h.newCheckContext()
+	defer cancel()
+
+	if err := h.queryRow(ctx, serverVersionQuery, &detail.ServerVersion); err != nil {
+		logrus.Errorf("Error executing server version query: %v", err)
+	}
+
+	if variables, err := h.getStatusVariables(ctx, wsrepStatusQuery); err != nil {
+		logrus.Errorf("Error executing wsrep status query: %v", err)
+	} else if value, ok := variables["wsrep_local_state"]; ok {
+		if state, err := strconv.Atoi(value); err == nil {
+			wsrepState := WsrepStatus(state)
+			detail.WsrepState = &wsrepState
+		}
+
+		detail.WsrepStateComment = variables["wsrep_local_state_comment"]
+		detail.Cluster = newClusterInfo(variables)
+	}
+
+	if readOnly, err := h.isReadOnly(ctx); err == nil {
+		detail.ReadOnly = &readOnly
+	}
+
+	var superReadOnly bool
+
+	err := h.queryRow(ctx, superReadOnlyQuery, &superReadOnly)
+
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownSystemVariable:
+		logrus.Debug("No super_read_only available, leaving it out of the detailed status.")
+	case err != nil:
+		logrus.Errorf("Error executing super_read_only query: %v", err)
+	default:
+		detail.SuperReadOnly = &superReadOnly
+	}
+
+	if lag, ok := h.getReplicationLag(ctx); ok {
+		detail.ReplicationLag = &lag
+	}
+}
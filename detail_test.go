@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestGetStatusDetailed(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(mock)
+
+	mock.ExpectPrepare(serverVersionQuery)
+	mock.ExpectQuery(serverVersionQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("10.6.16-MariaDB"))
+	mock.ExpectPrepare(wsrepStatusQuery)
+	mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).
+		AddRow("wsrep_local_state", "4").
+		AddRow("wsrep_local_state_comment", "Synced").
+		AddRow("wsrep_cluster_status", "Primary").
+		AddRow("wsrep_cluster_size", "3"))
+	mock.ExpectPrepare(readOnlyQuery)
+	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+	mock.ExpectPrepare(superReadOnlyQuery)
+	mock.ExpectQuery(superReadOnlyQuery).WillReturnError(&mysql.MySQLError{Number: errUnknownSystemVariable,
+		Message: "Unknown system variable 'super_read_only'"})
+	mock.ExpectPrepare(slaveStatusQuery)
+	mock.ExpectQuery(slaveStatusQuery).WillReturnRows(sqlmock.NewRows([]string{secondsBehindMasterColumn}))
+
+	dbHandler := &DBHandler{db: db, standby: true, coldStartChecks: 1, successThreshold: 2}
+
+	detail := dbHandler.GetStatusDetailed()
+
+	switch {
+	case detail.Status != Standby.String() || detail.Role != roleStandby:
+		t.Errorf("Expected a standby status and role but received %s and %s.", detail.Status, detail.Role)
+	case detail.ServerVersion != "10.6.16-MariaDB":
+		t.Errorf("Expected the server version but received %q.", detail.ServerVersion)
+	case detail.WsrepState == nil || *detail.WsrepState != Synced || detail.WsrepStateComment != "Synced":
+		t.Errorf("Expected the synced wsrep state but received %v (%q).", detail.WsrepState, detail.WsrepStateComment)
+	case detail.Cluster == nil || detail.Cluster.Size != 3:
+		t.Errorf("Expected a cluster of 3 nodes but received %+v.", detail.Cluster)
+	case detail.ReadOnly == nil || *detail.ReadOnly:
+		t.Errorf("Expected the node not to be read-only but received %v.", detail.ReadOnly)
+	case detail.SuperReadOnly != nil:
+		t.Errorf("Expected super_read_only to be omitted but received %v.", *detail.SuperReadOnly)
+	case detail.ReplicationLag == nil || *detail.ReplicationLag != 0:
+		t.Errorf("Expected no replication lag but received %v.", detail.ReplicationLag)
+	}
+
+	if cached := dbHandler.GetStatusDetailed(); cached != detail {
+		t.Error("Expected the detailed status to be cached.")
+	}
+
+	if dbHandler.checksRun != 0 || dbHandler.successStreak != 0 {
+		t.Errorf("Expected the detailed status to leave the routing state alone but %d checks were counted "+
+			"and %d successes.", dbHandler.checksRun, dbHandler.successStreak)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
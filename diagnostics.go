@@ -0,0 +1,67 @@
+/*
+Diagnostics.go gathers the state of the node along with the resolved config, for
+introspection during incidents.
+*/
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// redactedKeyParts lists the substrings of config key names whose values are
+// secrets, and are never served by the diagnostics endpoint.
+var redactedKeyParts = []string{"password", "token", "secret"}
+
+// Diagnostics is the detailed status of the node along with the resolved config.
+type Diagnostics struct {
+	Detail *StatusDetail
+	Config map[string]interface{}
+}
+
+// getDiagnostics returns the detailed status of the node, as cached by
+// GetStatusDetailed, for the caller to add the config it runs with.
+func (h *DBHandler) getDiagnostics() *Diagnostics {
+	return &Diagnostics{Detail: h.GetStatusDetailed()}
+}
+
+// redactedConfig returns all the settings of config, with the values of the keys
+// holding secrets replaced.
+func redactedConfig(config *viper.Viper) map[string]interface{} {
+	return redactSettings(config.AllSettings())
+}
+
+// redactSettings replaces the secret values in settings and the maps nested in it,
+// returning a copy so the config itself is left untouched.
+func redactSettings(settings map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+
+	for key, value := range settings {
+		switch {
+		case isSecretKey(key):
+			redacted[key] = "<redacted>"
+		default:
+			if nested, ok := value.(map[string]interface{}); ok {
+				value = redactSettings(nested)
+			}
+
+			redacted[key] = value
+		}
+	}
+
+	return redacted
+}
+
+// isSecretKey reports whether the config key name holds a secret.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, part := range redactedKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestServeHTTPDiagnostics(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %v", err)
+	}
+
+	config := CreateConfig("")
+	config.Set("connection.user", "monitor")
+	config.Set("connection.password", "s3cr3t")
+	config.Set("options.honor_offline_mode", false)
+	config.Set("options.require_primary_component", false)
+	config.Set("http.status_path", "/status")
+	config.Set("http.admin_token", "token")
+	config.Set("http.json_key_style", "camel")
+
+	expectSyncedRW(mock)
+	mock.ExpectPrepare(serverVersionQuery)
+	mock.ExpectQuery(serverVersionQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("10.6.16-MariaDB"))
+	mock.ExpectPrepare(wsrepStatusQuery)
+	mock.ExpectQuery(wsrepStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"variable", "value"}).
+		AddRow("wsrep_local_state", "4").
+		AddRow("wsrep_local_state_comment", "Synced").
+		AddRow("wsrep_cluster_status", "Primary").
+		AddRow("wsrep_cluster_size", "5"))
+	mock.ExpectPrepare(readOnlyQuery)
+	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+	mock.ExpectPrepare(superReadOnlyQuery)
+	mock.ExpectQuery(superReadOnlyQuery).WillReturnRows(sqlmock.NewRows([]string{"super_read_only"}).AddRow(0))
+	mock.ExpectPrepare(slaveStatusQuery)
+	mock.ExpectQuery(slaveStatusQuery).WillReturnRows(sqlmock.NewRows([]string{secondsBehindMasterColumn}))
+
+	httpHandler := NewHTTPServerHandler(config, CreateDBHandler(config, db))
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	recorder := httptest.NewRecorder()
+	httpHandler.serveHTTPDiagnostics(recorder, req)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without a token but received %d.", http.StatusUnauthorized, recorder.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer token")
+	recorder = httptest.NewRecorder()
+	httpHandler.serveHTTPDiagnostics(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d but received %d.", http.StatusOK, recorder.Code)
+	}
+
+	var response struct {
+		Status            string `json:"status"`
+		WsrepState        int    `json:"wsrepState"`
+		WsrepStateComment string `json:"wsrepStateComment"`
+		ReadOnly          bool   `json:"readOnly"`
+		Cluster           struct {
+			Size int `json:"size"`
+		} `json:"cluster"`
+		Config struct {
+			Connection map[string]interface{} `json:"connection"`
+			HTTP       map[string]interface{} `json:"http"`
+		} `json:"config"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode the diagnostics %s: %v", recorder.Body.String(), err)
+	}
+
+	switch {
+	case response.Status != Available.String():
+		t.Errorf("Expected the detailed status but received %s.", recorder.Body.String())
+	case response.WsrepState != int(Synced) || response.WsrepStateComment != "Synced":
+		t.Errorf("Expected the synced wsrep state but received %d (%q).", response.WsrepState,
+			response.WsrepStateComment)
+	case response.ReadOnly || response.Cluster.Size != 5:
+		t.Errorf("Expected a writable node in a cluster of 5 but received %s.", recorder.Body.String())
+	case response.Config.Connection["user"] != "monitor" || response.Config.HTTP["status_path"] != "/status":
+		t.Errorf("Expected the config keys verbatim but received %s.", recorder.Body.String())
+	case response.Config.Connection["password"] != "<redacted>" || response.Config.HTTP["admin_token"] != "<redacted>":
+		t.Errorf("Expected the secrets to be redacted but received %s.", recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRedactSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"connection": map[string]interface{}{
+			"user":     "monitor",
+			"password": "s3cr3t",
+		},
+		"http": map[string]interface{}{
+			"auth":           map[string]interface{}{"password": "s3cr3t"},
+			"override_token": "token",
+		},
+	}
+
+	redacted := redactSettings(settings)
+
+	connection := redacted["connection"].(map[string]interface{})
+	httpSettings := redacted["http"].(map[string]interface{})
+
+	switch {
+	case connection["user"] != "monitor":
+		t.Errorf("Expected the user to be kept but received %v.", connection["user"])
+	case connection["password"] != "<redacted>" || httpSettings["override_token"] != "<redacted>":
+		t.Errorf("Expected the secrets to be redacted but received %v.", redacted)
+	case httpSettings["auth"].(map[string]interface{})["password"] != "<redacted>":
+		t.Errorf("Expected the nested password to be redacted but received %v.", httpSettings["auth"])
+	case settings["connection"].(map[string]interface{})["password"] != "s3cr3t":
+		t.Error("Expected the settings to be left untouched.")
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Grpc.go provides the standard gRPC health checking service backed by the database health check.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCHealthServer serves the grpc.health.v1.Health service, reporting SERVING
+// when the node is available and NOT_SERVING otherwise.
+type GRPCHealthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	config    *viper.Viper
+	dbHandler *DBHandler
+	server    *grpc.Server
+}
+
+// NewGRPCHealthServer creates a new GRPCHealthServer with the supplied config and dbHandler.
+func NewGRPCHealthServer(config *viper.Viper, dbHandler *DBHandler) *GRPCHealthServer {
+	instance := new(GRPCHealthServer)
+	instance.config = config
+	instance.dbHandler = dbHandler
+	instance.server = grpc.NewServer()
+
+	healthpb.RegisterHealthServer(instance.server, instance)
+
+	return instance
+}
+
+// StartServer listens on the configured gRPC socket and serves health checks until
+// StopServer is called.
+func (g *GRPCHealthServer) StartServer() {
+	socket := net.JoinHostPort(g.config.GetString("grpc.addr"), g.config.GetString("grpc.port"))
+
+	listener, err := net.Listen("tcp", socket)
+	if err != nil {
+		logrus.Fatalf("Error opening gRPC socket: %v", err)
+	}
+
+	logrus.Info("Starting gRPC server.")
+
+	if err := g.server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		logrus.Fatalf("Error serving gRPC: %v", err)
+	}
+}
+
+// StopServer completes existing requests and shuts down the gRPC server gracefully.
+func (g *GRPCHealthServer) StopServer() {
+	g.server.GracefulStop()
+
+	logrus.Info("gRPC server stopped.")
+}
+
+// Check implements the grpc.health.v1.Health Check method.  The overall server
+// health is reported for an empty service name or the application name.
+func (g *GRPCHealthServer) Check(_ context.Context,
+	req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.GetService() != "" && req.GetService() != AppName {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+
+	if g.dbHandler.GetStatus().Status == Available {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+	}
+
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCHealthCheck(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	grpcServer := NewGRPCHealthServer(viper.New(), &DBHandler{db: db})
+
+	expectSyncedRW(mock)
+
+	resp, err := grpcServer.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected SERVING for an available node but received %v (%v).", resp.GetStatus(), err)
+	}
+
+	mock.ExpectPing().WillReturnError(context.DeadlineExceeded)
+
+	resp, err = grpcServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: AppName})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING for an unavailable node but received %v (%v).", resp.GetStatus(), err)
+	}
+
+	_, err = grpcServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown service but received %v.", err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Latency.go tracks the distribution of recent health check durations.
+*/
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultLatencyWindow is the number of recent check durations kept by default.
+const defaultLatencyWindow = 1024
+
+// LatencyWindow keeps the durations of the most recent health checks in a ring
+// buffer of fixed size, so memory stays bounded however long the daemon runs.
+type LatencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+// LatencyQuantiles summarizes the durations in a LatencyWindow, in seconds.
+type LatencyQuantiles struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50_seconds"`
+	P95     float64 `json:"p95_seconds"`
+	P99     float64 `json:"p99_seconds"`
+}
+
+// NewLatencyWindow creates a LatencyWindow holding up to size durations.
+func NewLatencyWindow(size int) *LatencyWindow {
+	if size < 1 {
+		size = defaultLatencyWindow
+	}
+
+	return &LatencyWindow{samples: make([]time.Duration, size)}
+}
+
+// Observe records the duration of a health check, replacing the oldest one if the
+// window is full.
+func (l *LatencyWindow) Observe(duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.samples[l.next] = duration
+	l.next = (l.next + 1) % len(l.samples)
+
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Quantiles returns the p50, p95 and p99 durations of the window, using the
+// nearest-rank method.  All quantiles are zero if no check was recorded yet.
+func (l *LatencyWindow) Quantiles() LatencyQuantiles {
+	l.mu.Lock()
+
+	count := l.next
+	if l.full {
+		count = len(l.samples)
+	}
+
+	sorted := make([]time.Duration, count)
+	copy(sorted, l.samples[:count])
+	l.mu.Unlock()
+
+	if count == 0 {
+		return LatencyQuantiles{}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	quantile := func(q float64) float64 {
+		rank := int(q*float64(count)+0.5) - 1
+		if rank < 0 {
+			rank = 0
+		} else if rank >= count {
+			rank = count - 1
+		}
+
+		return sorted[rank].Seconds()
+	}
+
+	return LatencyQuantiles{Samples: count, P50: quantile(0.5), P95: quantile(0.95), P99: quantile(0.99)}
+}
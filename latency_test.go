@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	window := NewLatencyWindow(100)
+
+	if quantiles := window.Quantiles(); quantiles != (LatencyQuantiles{}) {
+		t.Errorf("Expected zero quantiles for an empty window but received %+v.", quantiles)
+	}
+
+	// The first 50 slow samples are pushed out of the window by the next 100.
+	for i := 0; i < 50; i++ {
+		window.Observe(time.Hour)
+	}
+
+	for i := 1; i <= 100; i++ {
+		window.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	expected := LatencyQuantiles{Samples: 100, P50: 0.05, P95: 0.095, P99: 0.099}
+	if quantiles := window.Quantiles(); quantiles != expected {
+		t.Errorf("Expected quantiles %+v but received %+v.", expected, quantiles)
+	}
+}
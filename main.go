@@ -9,14 +9,18 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"flag"
 	"os"
 	"os/signal"
+	"reflect"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 const (
@@ -29,10 +33,86 @@ const (
 
 var version = "DEV-snapshot"
 
+// Exit codes of a standalone health check, one per ServerStatus, so shell scripts
+// and xinetd can tell why a node is not available.
+const (
+	exitAvailable   = 0
+	exitUnavailable = 1
+	exitReadOnly    = 2
+	exitNotReady    = 3
+	exitLagging     = 4
+	exitEvicted     = 5
+	// exitUnknown is returned for a status without a dedicated exit code.
+	exitUnknown = 6
+	// exitStandby follows exitUnknown, which scripts may already rely on.
+	exitStandby = 7
+)
+
+// Output formats of a standalone health check.
+const (
+	// outputText logs the result of the check.
+	outputText = "text"
+	// outputJSON prints the result of the check as a single JSON object on stdout.
+	outputJSON = "json"
+)
+
+// Formats of log.format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// levelFromFlags is set when the log level was set by the -v or -o flags, which
+// take precedence over log.level.
+var levelFromFlags bool
+
+// reasonMessages holds the status messages for results with a specific reason.
+var reasonMessages = map[Reason]string{
+	ReasonWsrepNotReady:       "MySQL cluster node is rejecting queries (wsrep not ready).",
+	ReasonRecovering:          "MySQL cluster node is recovering and not yet stable.",
+	ReasonHeartbeatMissing:    "Could not read the replication heartbeat of the MySQL cluster node.",
+	ReasonAuth:                "Could not authenticate to the MySQL cluster node.",
+	ReasonStarting:            "MySQL cluster node is still starting.",
+	ReasonCloneInProgress:     "MySQL node is being provisioned by a clone operation.",
+	ReasonCloneFailed:         "MySQL node failed to be provisioned by a clone operation.",
+	ReasonClockSkew:           "Clock of the MySQL cluster node is skewed.",
+	ReasonEvicted:             "MySQL cluster node was evicted from the cluster and must be restarted.",
+	ReasonNoQuorum:            "MySQL cluster node is the only member of its cluster.",
+	ReasonDiskFull:            "MySQL cluster node is read-only after running out of disk space.",
+	ReasonDatabaseMissing:     "Target database of the MySQL cluster node is missing.",
+	ReasonOfflineMode:         "MySQL cluster node is draining (offline_mode).",
+	ReasonReadFailed:          "MySQL cluster node failed the read probe.",
+	ReasonWriteFailed:         "MySQL cluster node failed the write probe.",
+	ReasonResultTooLarge:      "Result of the custom health query is too large.",
+	ReasonReplicationLag:      "MySQL replica is lagging behind its source.",
+	ReasonReplicationStopped:  "Replication of the MySQL replica is not running.",
+	ReasonSeqnoGap:            "MySQL cluster node is behind the cluster's committed position.",
+	ReasonPreCheckFailed:      "Local pre-check of the MySQL cluster node host failed.",
+	ReasonCircuitOpen:         "Health checks of the MySQL cluster node are paused after repeated failures.",
+	ReasonStalled:             "MySQL cluster node has stopped applying replicated transactions.",
+	ReasonReceivingSST:        "MySQL cluster node is joining and receiving a State Snapshot Transfer.",
+	ReasonNotPrimary:          "MySQL cluster node is not a writable primary.",
+	ReasonBinlogDisabled:      "MySQL node has binary logging disabled and cannot replicate its writes.",
+	ReasonNonPrimaryComponent: "MySQL cluster node is synced but not part of the primary component.",
+	ReasonMaintenance:         "MySQL cluster node is in maintenance.",
+}
+
 func main() {
 	daemonMode := flag.Bool("d", false, "Run as a daemon and listen for HTTP connections on a socket")
 	logVerbose := flag.Bool("v", false, "Verbose (debug) logging")
 	printVersion := flag.Bool("V", false, "Print version and exit")
+	wait := flag.Bool("wait", false, "In standalone mode, repeat the health check until the node is ready")
+	waitTimeout := flag.Duration("wait-timeout", time.Minute, "Maximum time to wait for the node to become ready")
+	waitInterval := flag.Duration("wait-interval", time.Second, "Time between health checks while waiting")
+	startup := flag.Bool("startup", false, "Report an unreachable database server as still starting during the startup grace period")
+	startupGrace := flag.Duration("startup-grace", 5*time.Minute, "Length of the startup grace period")
+	validate := flag.Bool("validate", false, "Validate the config by connecting and running a single health check, then exit")
+	output := flag.String("o", outputText, "Output format of the standalone health check, either text or json")
+
+	var configFile string
+
+	flag.StringVar(&configFile, "c", "", "Path of the config file, instead of searching the default locations")
+	flag.StringVar(&configFile, "config", "", "Path of the config file, instead of searching the default locations")
 	flag.Parse()
 
 	if *printVersion {
@@ -42,123 +122,493 @@ func main() {
 		os.Exit(0)
 	}
 
+	switch *output {
+	case outputText, outputJSON:
+	default:
+		logrus.Errorf("Unknown output format %q, using %q", *output, outputText)
+		*output = outputText
+	}
+
 	if *logVerbose {
 		logrus.SetLevel(logrus.DebugLevel)
+		levelFromFlags = true
+	} else if *output == outputJSON && !*daemonMode {
+		// Keep stderr quiet for scripts, save for errors.
+		logrus.SetLevel(logrus.ErrorLevel)
+		levelFromFlags = true
+	}
+
+	var startupGraceUntil time.Time
+	if *startup {
+		startupGraceUntil = time.Now().Add(*startupGrace)
+	}
+
+	if *validate {
+		os.Exit(runValidation(configFile))
 	}
 
 	switch *daemonMode {
 	case true:
-		runDaemon()
+		runDaemon(configFile, startupGraceUntil)
 	default:
-		runStandaloneHealthCheck()
+		if !*wait {
+			*waitTimeout, *waitInterval = 0, 0
+		}
+
+		os.Exit(exitCodeFor(runStandaloneHealthCheck(configFile, *waitTimeout, *waitInterval, startupGraceUntil,
+			*output)))
 	}
 }
 
-// runDaemon starts an HTTP server instance and listens for OS signals.
-func runDaemon() {
-	var httpHandler *HTTPServerHandler
+// daemon holds the HTTP server of a running daemon, which is replaced on every
+// reload, so signals can safely reach it from another goroutine.
+type daemon struct {
+	mu          sync.Mutex
+	httpHandler *HTTPServerHandler
+	shutdown    bool
+
+	// shutdownReason describes the signal which shut the daemon down, and tally
+	// counts the results served by all HTTP servers for the shutdown summary.
+	shutdownReason string
+	tally          *ResultTally
+
+	// listeners are the HTTP sockets kept open across reloads, as long as the
+	// listenKeys of the config hold the same values.
+	listeners      []*sharedListener
+	listenSettings []interface{}
+}
+
+// listenKeys are the config keys which the HTTP sockets are opened with.
+var listenKeys = []string{"http.addr", "http.port", "http.network", "http.unix_socket", "http.socket_mode"}
 
-	shutdown := false
+// runDaemon starts an HTTP server instance and listens for OS signals.  A refused
+// database connection is reported as still starting until startupGraceUntil.
+func runDaemon(configFile string, startupGraceUntil time.Time) {
+	d := new(daemon)
+	d.tally = NewResultTally()
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	go func() {
-		for {
-			s := <-sigs
+	go d.handleSignals(sigs)
 
-			logrus.Debugf("Received %s signal", s)
+	d.run(func() *viper.Viper {
+		config := CreateConfig(configFile)
+		applyLogConfig(config)
+
+		return config
+	}, startupGraceUntil)
+}
 
-			switch s {
-			case syscall.SIGHUP:
-				logrus.Info("Triggering reload of config, database connections and HTTP server...")
+// handleSignals stops the running HTTP server on every signal received, either to
+// reload it on SIGHUP or to shut the daemon down.  A signal received while no
+// server is running only takes effect on the next server, if at all.
+func (d *daemon) handleSignals(sigs <-chan os.Signal) {
+	for s := range sigs {
+		logrus.Debugf("Received %s signal", s)
+
+		d.mu.Lock()
+
+		switch s {
+		case syscall.SIGHUP:
+			logrus.Info("Triggering reload of config, database connections and HTTP server...")
+		case syscall.SIGINT, syscall.SIGTERM:
+			d.shutdown = true
+			d.shutdownReason = "received " + s.String() + " signal"
+		}
 
-				httpHandler.StopServer()
-			case syscall.SIGINT, syscall.SIGTERM:
-				shutdown = true
+		httpHandler := d.httpHandler
+		d.mu.Unlock()
 
-				httpHandler.StopServer()
-			}
+		if httpHandler != nil {
+			httpHandler.StopServer()
 		}
-	}()
+	}
+}
 
-	for !shutdown {
-		config := CreateConfig()
-		dsn := BuildDSN(config)
+// run serves health checks with a freshly loaded config until shutdown is requested.
+func (d *daemon) run(createConfig func() *viper.Viper, startupGraceUntil time.Time) {
+	for {
+		config := createConfig()
 
-		db, err := sql.Open("mysql", dsn)
+		dsn, err := BuildDSN(config)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 
-		defer func() {
-			err := db.Close()
-			if err != nil {
-				logrus.Fatalf("Error closing the database connection: %v", err)
+		dbHandler, err := openDBHandler(config, dsn, startupGraceUntil)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		portHandlers := openPortHandlers(config, startupGraceUntil)
+
+		d.mu.Lock()
+		shutdown := d.shutdown
+		if !shutdown {
+			d.httpHandler = NewHTTPServerHandler(config, dbHandler)
+			d.keepListeners(config)
+			d.httpHandler.UseListeners(d.listeners)
+
+			if d.tally != nil && config.GetBool("http.shutdown_summary") {
+				d.httpHandler.SetResultTally(d.tally)
+			}
+
+			for port, portHandler := range portHandlers {
+				d.httpHandler.AddPort(port, portHandler)
 			}
-		}()
+		}
+		httpHandler := d.httpHandler
+		d.mu.Unlock()
 
-		dbHandler := CreateDBHandler(config, db)
-		httpHandler = NewHTTPServerHandler(config, dbHandler)
+		if !shutdown {
+			httpHandler.StartServer()
 
-		httpHandler.StartServer()
+			// HTTPHandler blocks here on HTTP server execution.  Next line will run
+			// only after the HTTP server is shutdown.
 
-		// HTTPHandler blocks here on HTTP server execution.  Next line will run
-		// only after the HTTP server is shutdown.
+			d.mu.Lock()
+			d.httpHandler = nil
+			shutdown = d.shutdown
+			d.mu.Unlock()
+		}
 
-		err = db.Close()
+		err = dbHandler.db.Close()
 		if err != nil {
 			logrus.Fatalf("Error closing the database connection: %v", err)
 		}
+
+		for port, portHandler := range portHandlers {
+			if err := portHandler.db.Close(); err != nil {
+				logrus.Fatalf("Error closing the database connection to port %d: %v", port, err)
+			}
+		}
+
+		if shutdown {
+			d.mu.Lock()
+			d.releaseListeners()
+			d.mu.Unlock()
+
+			if d.tally != nil && config.GetBool("http.shutdown_summary") {
+				d.mu.Lock()
+				reason := d.shutdownReason
+				d.mu.Unlock()
+
+				d.tally.LogSummary(reason)
+			}
+
+			return
+		}
+	}
+}
+
+// keepListeners opens the HTTP sockets of config for the new server, unless those of
+// the previous server were opened with the same settings, in which case they are
+// kept so the endpoints stay reachable across the reload.  d.mu must be held.
+func (d *daemon) keepListeners(config *viper.Viper) {
+	settings := make([]interface{}, len(listenKeys))
+	for i, key := range listenKeys {
+		settings[i] = config.Get(key)
+	}
+
+	if d.listeners != nil && reflect.DeepEqual(settings, d.listenSettings) {
+		logrus.Debug("Keeping the HTTP sockets open across the reload")
+		return
+	}
+
+	d.releaseListeners()
+	d.listeners = d.httpHandler.listenShared()
+	d.listenSettings = settings
+}
+
+// releaseListeners closes the HTTP sockets kept open across reloads.  d.mu must be
+// held.
+func (d *daemon) releaseListeners() {
+	for _, listener := range d.listeners {
+		if err := listener.release(); err != nil {
+			logrus.Errorf("Error closing HTTP socket: %v", err)
+		}
+	}
+
+	d.listeners = nil
+}
+
+// applyLogConfig sets the log format and, unless set by flags, the log level from
+// the log section of config.
+func applyLogConfig(config *viper.Viper) {
+	logrus.SetFormatter(logFormatter(config.GetString("log.format")))
+
+	if levelFromFlags {
+		return
+	}
+
+	level, err := logrus.ParseLevel(config.GetString("log.level"))
+	if err != nil {
+		logrus.Errorf("Unknown log.level %q, using %q", config.GetString("log.level"), logrus.InfoLevel)
+		level = logrus.InfoLevel
+	}
+
+	logrus.SetLevel(level)
+}
+
+// logFormatter returns the formatter of the log format, or the text formatter if
+// format is unknown.
+func logFormatter(format string) logrus.Formatter {
+	switch format {
+	case logFormatJSON:
+		return &logrus.JSONFormatter{}
+	case "", logFormatText:
+	default:
+		logrus.Errorf("Unknown log.format %q, using %q", format, logFormatText)
+	}
+
+	return &logrus.TextFormatter{}
+}
+
+// openPortHandlers opens a DBHandler for each of the additional instances in
+// connection.ports, which share the rest of the connection config.
+func openPortHandlers(config *viper.Viper, startupGraceUntil time.Time) map[int]*DBHandler {
+	ports := config.GetIntSlice("connection.ports")
+	if len(ports) == 0 {
+		return nil
+	}
+
+	portHandlers := make(map[int]*DBHandler, len(ports))
+
+	for _, port := range ports {
+		dsn, err := BuildPortDSN(config, port)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		dbHandler, err := openDBHandler(config, dsn, startupGraceUntil)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		portHandlers[port] = dbHandler
+	}
+
+	return portHandlers
+}
+
+// openDBHandler opens the database at dsn and returns a DBHandler for it,
+// reporting a refused connection as still starting until startupGraceUntil.
+func openDBHandler(config *viper.Viper, dsn string, startupGraceUntil time.Time) (*DBHandler, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	dbHandler, err := NewDBHandler(config, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	dbHandler.SetStartupGrace(startupGraceUntil)
+
+	return dbHandler, nil
+}
+
+// openStandaloneDBHandler opens the database handler of a standalone health
+// check as openDBHandler does, limited to a single connection unless
+// connection.pool.standalone_single_connection is disabled.
+func openStandaloneDBHandler(config *viper.Viper, dsn string, startupGraceUntil time.Time) (*DBHandler, error) {
+	dbHandler, err := openDBHandler(config, dsn, startupGraceUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.GetBool("connection.pool.standalone_single_connection") {
+		dbHandler.UseSingleConnection()
+	}
+
+	return dbHandler, nil
+}
+
+// runValidation validates the config for the -validate flag: it connects to the
+// database server and runs a single health check, and returns the exit code of
+// the check, or exitUnavailable if the connection failed.
+func runValidation(configFile string) int {
+	config := CreateConfig(configFile)
+	applyLogConfig(config)
+
+	dsn, err := BuildDSN(config)
+	if err != nil {
+		logrus.Errorf("Config is invalid: %v", err)
+		return exitUnavailable
+	}
+
+	dbHandler, err := openDBHandler(config, dsn, time.Time{})
+	if err != nil {
+		logrus.Errorf("Config is invalid: %v", err)
+		return exitUnavailable
+	}
+
+	defer dbHandler.db.Close()
+
+	return validateDBHandler(dbHandler)
+}
+
+// validateDBHandler checks the connection of dbHandler, explaining why it failed if
+// it did, then runs a single health check and returns its exit code.
+func validateDBHandler(dbHandler *DBHandler) int {
+	ctx, cancel := dbHandler.newCheckContext()
+	defer cancel()
+
+	if err := dbHandler.validateConnection(ctx); err != nil {
+		logrus.Errorf("Could not connect to the database server: %s", describeConnectionError(err))
+		return exitUnavailable
+	}
+
+	logrus.Info("Connected to the database server.")
+
+	result := dbHandler.GetStatus()
+	if result.Status != Available {
+		logrus.Warnf("Config is valid, but the health check failed: %s", statusMessage(result))
+	} else {
+		logrus.Infof("Config is valid: %s", statusMessage(result))
 	}
+
+	return exitCodeFor(result.Status)
 }
 
 // RunStatusCheck queries the current state of the database and returns a boolean
-// and status message indicating if the database is available.
+// and status message indicating if the database is available.  The result is not
+// recorded in the metrics, which only the daemon serves.
 func RunStatusCheck(dbHandler *DBHandler) (bool, string) {
-	switch dbHandler.GetStatus() {
+	result := dbHandler.GetStatus()
+
+	return result.Status == Available, statusMessage(result)
+}
+
+// statusMessage returns the human-readable status message for a check result.
+func statusMessage(result CheckResult) string {
+	if msg, ok := reasonMessages[result.Reason]; ok {
+		return msg
+	}
+
+	switch result.Status {
 	case Available:
-		return true, "MySQL cluster node is ready."
+		return "MySQL cluster node is ready."
 	case Unavailable:
-		return false, "Could not connect to the MySQL cluster node."
+		return "Could not connect to the MySQL cluster node."
 	case ReadOnly:
-		return false, "MySQL cluster node is read-only."
+		return "MySQL cluster node is read-only."
 	case NotReady:
-		return false, "MySQL cluster node is not ready."
+		return "MySQL cluster node is not ready."
+	case Lagging:
+		return "MySQL cluster node is lagging behind."
+	case Evicted:
+		return "MySQL cluster node was evicted from the cluster."
+	case Standby:
+		return "MySQL cluster node is ready as a standby."
 	}
 
-	return false, "Unknown error encountered running health check."
+	return "Unknown error encountered running health check."
 }
 
 // runStandaloneHealthCheck runs a single health check against the target database
-// and returns the result via log messages and os.Exit().
-func runStandaloneHealthCheck() bool {
-	config := CreateConfig()
-	dsn := BuildDSN(config)
+// and returns the result via log messages and os.Exit().  If waitTimeout is set,
+// the check is repeated every waitInterval until the node is ready or the
+// timeout expires.  A refused database connection is reported as still starting
+// until startupGraceUntil.  With the json output format, the result is printed to
+// stdout instead of logged.
+func runStandaloneHealthCheck(configFile string, waitTimeout time.Duration, waitInterval time.Duration,
+	startupGraceUntil time.Time, output string) ServerStatus {
+	config := CreateConfig(configFile)
+	applyLogConfig(config)
+
+	dsn, err := BuildDSN(config)
+	if err != nil {
+		logrus.Fatal(err)
+	}
 
-	db, err := sql.Open("mysql", dsn)
+	dbHandler, err := openStandaloneDBHandler(config, dsn, startupGraceUntil)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
 	defer func() {
-		err := db.Close()
+		err := dbHandler.db.Close()
 		if err != nil {
 			logrus.Fatalf("Error closing the database connection: %v", err)
 		}
 	}()
 
-	dbHandler := CreateDBHandler(config, db)
-
 	logrus.Debug("Running standalone health check.")
 
-	ready, msg := RunStatusCheck(dbHandler)
+	start := time.Now()
+	result := waitForReady(dbHandler, waitTimeout, waitInterval)
 
-	if ready {
-		logrus.Info(msg)
+	if output == outputJSON {
+		if err := printStandaloneResult(result, time.Since(start)); err != nil {
+			logrus.Errorf("Error printing the health check result: %v", err)
+		}
+	} else if result.Status == Available {
+		logrus.Info(statusMessage(result))
 	} else {
-		logrus.Warn(msg)
+		logrus.Warn(statusMessage(result))
 	}
 
-	return ready
+	return result.Status
+}
+
+// standaloneResult is the output of a standalone health check in JSON format.
+type standaloneResult struct {
+	Status    string  `json:"status"`
+	Ready     bool    `json:"ready"`
+	Message   string  `json:"message"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// printStandaloneResult prints result as a single line of JSON to stdout, along
+// with the time taken to reach it.
+func printStandaloneResult(result CheckResult, latency time.Duration) error {
+	return json.NewEncoder(os.Stdout).Encode(standaloneResult{
+		Status:    result.Status.String(),
+		Ready:     result.Status == Available,
+		Message:   statusMessage(result),
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	})
+}
+
+// exitCodeFor returns the exit code of a standalone health check finding status.
+func exitCodeFor(status ServerStatus) int {
+	switch status {
+	case Available:
+		return exitAvailable
+	case Unavailable:
+		return exitUnavailable
+	case ReadOnly:
+		return exitReadOnly
+	case NotReady:
+		return exitNotReady
+	case Lagging:
+		return exitLagging
+	case Evicted:
+		return exitEvicted
+	case Standby:
+		return exitStandby
+	}
+
+	return exitUnknown
+}
+
+// waitForReady runs health checks every interval until the database is ready or
+// the timeout expires, and returns the result of the last check.  A single check
+// is run if timeout is zero.
+func waitForReady(dbHandler *DBHandler, timeout time.Duration, interval time.Duration) CheckResult {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		result := dbHandler.GetStatus()
+		if result.Status == Available || time.Now().Add(interval).After(deadline) {
+			return result
+		}
+
+		logrus.Debugf("Node not ready yet (%s), retrying in %s.", statusMessage(result), interval)
+		time.Sleep(interval)
+	}
 }
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.uber.org/goleak"
+)
+
+func TestDaemonSignalsAtStartup(t *testing.T) {
+	createConfig := func() *viper.Viper {
+		config := CreateConfig("")
+		config.Set("http.addr", "127.0.0.1")
+		config.Set("http.port", 0)
+
+		return config
+	}
+
+	d := new(daemon)
+
+	// The reload is requested before the first HTTP server exists.
+	sigs := make(chan os.Signal, 2)
+	sigs <- syscall.SIGHUP
+	sigs <- syscall.SIGTERM
+
+	go d.handleSignals(sigs)
+
+	done := make(chan struct{})
+
+	go func() {
+		d.run(createConfig, time.Time{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not shut down after signals received at startup.")
+	}
+
+	close(sigs)
+}
+
+func TestHandleSignalsWithoutServer(t *testing.T) {
+	d := new(daemon)
+
+	sigs := make(chan os.Signal, 1)
+	sigs <- syscall.SIGHUP
+	close(sigs)
+
+	// No HTTP server is running yet, so the reload must be a no-op.
+	d.handleSignals(sigs)
+
+	if d.shutdown {
+		t.Error("Expected SIGHUP not to shut the daemon down.")
+	}
+}
+
+func TestDaemonReloadKeepsListeners(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	var reloads atomic.Int32
+
+	createConfig := func() *viper.Viper {
+		config := CreateConfig("")
+		config.Set("http.addr", addr)
+		config.Set("options.check_timeout", "100ms")
+
+		// The reloaded config serves health checks at another path.
+		if reloads.Add(1) == 1 {
+			config.Set("http.path", "/before")
+		} else {
+			config.Set("http.path", "/after")
+		}
+
+		return config
+	}
+
+	// getStatus waits for the HTTP server to serve path with a status other than 404.
+	getStatus := func(path string) {
+		for deadline := time.Now().Add(5 * time.Second); ; {
+			resp, err := http.Get("http://" + addr + path)
+			if err == nil {
+				resp.Body.Close()
+
+				if resp.StatusCode != http.StatusNotFound {
+					return
+				}
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected a health check to be served at %s, last error: %v", path, err)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	d := new(daemon)
+	sigs := make(chan os.Signal, 1)
+
+	go d.handleSignals(sigs)
+
+	done := make(chan struct{})
+
+	go func() {
+		d.run(createConfig, time.Time{})
+		close(done)
+	}()
+
+	getStatus("/before")
+
+	d.mu.Lock()
+	listeners := d.listeners
+	d.mu.Unlock()
+
+	sigs <- syscall.SIGHUP
+
+	getStatus("/after")
+
+	d.mu.Lock()
+	kept := len(d.listeners) == 1 && d.listeners[0] == listeners[0]
+	d.mu.Unlock()
+
+	if !kept {
+		t.Error("Expected the HTTP socket to be kept open across the reload.")
+	}
+
+	sigs <- syscall.SIGTERM
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not shut down after SIGTERM.")
+	}
+
+	close(sigs)
+
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("Expected the HTTP socket to be closed after shutdown.")
+	}
+}
+
+func TestDaemonShutdownLeaksNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	createConfig := func() *viper.Viper {
+		config := CreateConfig("")
+		config.Set("http.addr", "127.0.0.1")
+		config.Set("http.port", 0)
+		config.Set("grpc.addr", "127.0.0.1")
+		config.Set("grpc.port", 0)
+
+		return config
+	}
+
+	d := new(daemon)
+	sigs := make(chan os.Signal, 1)
+
+	go d.handleSignals(sigs)
+
+	done := make(chan struct{})
+
+	go func() {
+		d.run(createConfig, time.Time{})
+		close(done)
+	}()
+
+	// Wait for the HTTP server to be registered before requesting the shutdown.
+	for {
+		d.mu.Lock()
+		started := d.httpHandler != nil
+		d.mu.Unlock()
+
+		if started {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sigs <- syscall.SIGTERM
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not shut down after SIGTERM.")
+	}
+
+	close(sigs)
+}
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		status   ServerStatus
+		expected int
+	}{
+		{Available, 0},
+		{Unavailable, 1},
+		{ReadOnly, 2},
+		{NotReady, 3},
+		{Lagging, 4},
+		{Evicted, 5},
+		{Standby, 7},
+		{ServerStatus(-1), 6},
+	}
+
+	for _, test := range tests {
+		if code := exitCodeFor(test.status); code != test.expected {
+			t.Errorf("Expected exit code %d for status %s but received %d.", test.expected, test.status, code)
+		}
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		timeout  time.Duration
+		expected int
+	}{
+		{"ready at once", 0, 0, exitAvailable},
+		{"ready after retries", 2, time.Second, exitAvailable},
+		{"never ready", -1, 50 * time.Millisecond, exitUnavailable},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		if test.failures < 0 {
+			// More failed pings than the timeout leaves room for.
+			for i := 0; i < 10; i++ {
+				mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+			}
+		} else {
+			for i := 0; i < test.failures; i++ {
+				mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+			}
+
+			expectSyncedRW(mock)
+		}
+
+		result := waitForReady(&DBHandler{db: db}, test.timeout, 10*time.Millisecond)
+
+		if code := exitCodeFor(result.Status); code != test.expected {
+			t.Errorf("Expected exit code %d when %s but received %d.", test.expected, test.name, code)
+		}
+
+		if test.failures >= 0 {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("There were unfulfilled expectations when %s: %s", test.name, err)
+			}
+		}
+	}
+}
+
+func TestOpenStandaloneDBHandler(t *testing.T) {
+	tests := []struct {
+		singleConnection bool
+		expected         int
+	}{
+		{true, 1},
+		{false, 5},
+	}
+
+	for _, test := range tests {
+		config := CreateConfig("")
+		config.Set("connection.pool.max_open_conns", 5)
+		config.Set("connection.pool.standalone_single_connection", test.singleConnection)
+
+		dsn, err := BuildDSN(config)
+		if err != nil {
+			t.Fatalf("Failed to build DSN: %v", err)
+		}
+
+		// Opening the handler does not connect, so no database server is needed.
+		dbHandler, err := openStandaloneDBHandler(config, dsn, time.Time{})
+		if err != nil {
+			t.Fatalf("Failed to open the database handler: %v", err)
+		}
+
+		if open := dbHandler.db.Stats().MaxOpenConnections; open != test.expected {
+			t.Errorf("Expected at most %d open connections with standalone_single_connection %t but received %d.",
+				test.expected, test.singleConnection, open)
+		}
+
+		dbHandler.db.Close()
+	}
+}
+
+func TestValidateDBHandler(t *testing.T) {
+	tests := []struct {
+		pingErr  error
+		expected int
+	}{
+		{nil, exitAvailable},
+		{&mysql.MySQLError{Number: errAccessDenied, Message: "Access denied for user 'healthcheck'"}, exitUnavailable},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		if test.pingErr != nil {
+			mock.ExpectPing().WillReturnError(test.pingErr)
+		} else {
+			mock.ExpectPing()
+			expectSyncedRW(mock)
+		}
+
+		if code := validateDBHandler(&DBHandler{db: db}); code != test.expected {
+			t.Errorf("Expected exit code %d with ping error %v but received %d.", test.expected, test.pingErr, code)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestPrintStandaloneResult(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	err = printStandaloneResult(CheckResult{Status: NotReady, Reason: ReasonRecovering}, 1500*time.Microsecond)
+
+	os.Stdout = stdout
+	writer.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to print the result: %v", err)
+	}
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read stdout: %v", err)
+	}
+
+	var result standaloneResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		t.Fatalf("Expected valid JSON on stdout but received %q: %v", output, err)
+	}
+
+	expected := standaloneResult{
+		Status:    "notready",
+		Ready:     false,
+		Message:   reasonMessages[ReasonRecovering],
+		LatencyMs: 1.5,
+	}
+	if result != expected {
+		t.Errorf("Expected %+v but received %+v.", expected, result)
+	}
+}
+
+func TestLogFormatter(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected logrus.Formatter
+	}{
+		{"", &logrus.TextFormatter{}},
+		{logFormatText, &logrus.TextFormatter{}},
+		{logFormatJSON, &logrus.JSONFormatter{}},
+		{"logfmt", &logrus.TextFormatter{}},
+	}
+
+	for _, test := range tests {
+		if formatter := logFormatter(test.format); reflect.TypeOf(formatter) != reflect.TypeOf(test.expected) {
+			t.Errorf("Expected a %T for log.format %q but received a %T.", test.expected, test.format, formatter)
+		}
+	}
+}
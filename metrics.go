@@ -0,0 +1,151 @@
+/*
+Metrics.go provides the Prometheus metrics exported by the daemon.
+*/
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+// Metrics holds the Prometheus collectors exported by the daemon.
+type Metrics struct {
+	registry     *prometheus.Registry
+	results      *prometheus.CounterVec
+	requests     prometheus.Counter
+	status       *prometheus.GaugeVec
+	lastLatency  prometheus.Gauge
+	coldLatency  prometheus.Gauge
+	instanceName string
+	reasonLabel  bool
+}
+
+// NewMetrics creates a new set of collectors in a dedicated registry.  The result
+// metric carries a "reason" label if metrics.reason_label is set, and an
+// "instance_name" label if metrics.instance_name is set.
+func NewMetrics(config *viper.Viper) *Metrics {
+	instance := new(Metrics)
+	instance.registry = prometheus.NewRegistry()
+	instance.instanceName = config.GetString("metrics.instance_name")
+	instance.reasonLabel = config.GetBool("metrics.reason_label")
+
+	labels := []string{"result"}
+	if instance.reasonLabel {
+		labels = append(labels, "reason")
+	}
+
+	if instance.instanceName != "" {
+		labels = append(labels, "instance_name")
+	}
+
+	instance.results = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "healthcheck_results_total",
+		Help: "Number of health checks by result.",
+	}, labels)
+
+	instance.requests = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "healthcheck_requests_total",
+		Help: "Number of health check requests served.",
+	})
+
+	instance.status = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_status",
+		Help: "Whether the last health check found the node in the given state.",
+	}, []string{"state"})
+
+	instance.lastLatency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "healthcheck_last_check_latency_seconds",
+		Help: "Duration of the last health check.",
+	})
+
+	instance.coldLatency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "healthcheck_coldstart_check_latency_seconds",
+		Help: "Duration of the last cold-start health check, excluded from the other latency metrics.",
+	})
+
+	instance.registry.MustRegister(instance.results, instance.requests, instance.status, instance.lastLatency,
+		instance.coldLatency)
+
+	return instance
+}
+
+// ObserveResult records the result and duration of a health check request.  The
+// duration of a cold-start check is recorded apart from that of other checks.
+func (m *Metrics) ObserveResult(result CheckResult, duration time.Duration, coldStart bool) {
+	m.requests.Inc()
+
+	if coldStart {
+		m.coldLatency.Set(duration.Seconds())
+	} else {
+		m.lastLatency.Set(duration.Seconds())
+	}
+
+	for _, status := range []ServerStatus{Available, ReadOnly, NotReady, Unavailable, Lagging, Evicted, Standby} {
+		value := 0.0
+		if status == result.Status {
+			value = 1
+		}
+
+		m.status.WithLabelValues(status.String()).Set(value)
+	}
+
+	labels := prometheus.Labels{"result": result.Status.String()}
+
+	if m.reasonLabel {
+		// Reasons are a fixed enumeration, which keeps the label cardinality bounded.
+		reason := string(result.Reason)
+		if reason == "" {
+			reason = "none"
+		}
+
+		labels["reason"] = reason
+	}
+
+	if m.instanceName != "" {
+		labels["instance_name"] = m.instanceName
+	}
+
+	m.results.With(labels).Inc()
+}
+
+// RegisterLatencies exports the p50, p95 and p99 durations of the recent health
+// checks in window as the healthcheck_check_latency_seconds gauge.
+func (m *Metrics) RegisterLatencies(window *LatencyWindow) {
+	quantiles := map[string]func(LatencyQuantiles) float64{
+		"0.5":  func(q LatencyQuantiles) float64 { return q.P50 },
+		"0.95": func(q LatencyQuantiles) float64 { return q.P95 },
+		"0.99": func(q LatencyQuantiles) float64 { return q.P99 },
+	}
+
+	for quantile, value := range quantiles {
+		value := value
+
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "healthcheck_check_latency_seconds",
+			Help:        "Duration of recent health checks by quantile.",
+			ConstLabels: prometheus.Labels{"quantile": quantile},
+		}, func() float64 {
+			return value(window.Quantiles())
+		}))
+	}
+}
+
+// RegisterCertExpiry exports the time left until the TLS client certificate
+// expires as the healthcheck_tls_client_cert_expiry_seconds gauge.
+func (m *Metrics) RegisterCertExpiry(certExpiry *CertExpiry) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "healthcheck_tls_client_cert_expiry_seconds",
+		Help: "Time left until the TLS client certificate expires.",
+	}, func() float64 {
+		return certExpiry.Remaining().Seconds()
+	}))
+}
+
+// Handler returns an HTTP handler exposing the metrics in the Prometheus format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+)
+
+func TestObserveResultLabels(t *testing.T) {
+	config := viper.New()
+	config.Set("metrics.reason_label", true)
+	config.Set("metrics.instance_name", "db01")
+
+	metrics := NewMetrics(config)
+	metrics.ObserveResult(CheckResult{Status: Unavailable, Reason: ReasonAuth}, time.Millisecond, false)
+	metrics.ObserveResult(CheckResult{Status: Available}, time.Millisecond, false)
+
+	counter := metrics.results.WithLabelValues("unavailable", "auth", "db01")
+	if count := testutil.ToFloat64(counter); count != 1 {
+		t.Errorf("Expected 1 unavailable result with reason auth but received %v.", count)
+	}
+
+	counter = metrics.results.WithLabelValues("available", "none", "db01")
+	if count := testutil.ToFloat64(counter); count != 1 {
+		t.Errorf("Expected 1 available result with reason none but received %v.", count)
+	}
+}
+
+func TestRegisterLatencies(t *testing.T) {
+	window := NewLatencyWindow(10)
+	for i := 1; i <= 10; i++ {
+		window.Observe(time.Duration(i) * time.Second)
+	}
+
+	metrics := NewMetrics(viper.New())
+	metrics.RegisterLatencies(window)
+
+	expected := `
+# HELP healthcheck_check_latency_seconds Duration of recent health checks by quantile.
+# TYPE healthcheck_check_latency_seconds gauge
+healthcheck_check_latency_seconds{quantile="0.5"} 5
+healthcheck_check_latency_seconds{quantile="0.95"} 10
+healthcheck_check_latency_seconds{quantile="0.99"} 10
+`
+
+	err := testutil.GatherAndCompare(metrics.registry, strings.NewReader(expected), "healthcheck_check_latency_seconds")
+	if err != nil {
+		t.Errorf("Unexpected latency metrics: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Precheck.go provides local checks of host-level conditions run ahead of the database checks.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultPreCheckTimeout is how long a pre-check command may run by default.
+const defaultPreCheckTimeout = 5 * time.Second
+
+// PreCheck gates readiness on conditions of the local host, such as a mount being
+// present or a maintenance flag file being absent, without a separate sidecar.
+type PreCheck struct {
+	command    []string
+	fileExists string
+	fileAbsent string
+	timeout    time.Duration
+}
+
+// NewPreCheck creates a PreCheck from options.pre_check, or returns nil if no
+// pre-check is configured.
+func NewPreCheck(config *viper.Viper) *PreCheck {
+	preCheck := &PreCheck{
+		command:    config.GetStringSlice("options.pre_check.command"),
+		fileExists: config.GetString("options.pre_check.file_exists"),
+		fileAbsent: config.GetString("options.pre_check.file_absent"),
+		timeout:    config.GetDuration("options.pre_check.timeout"),
+	}
+
+	if len(preCheck.command) == 0 && preCheck.fileExists == "" && preCheck.fileAbsent == "" {
+		return nil
+	}
+
+	if preCheck.timeout <= 0 {
+		preCheck.timeout = defaultPreCheckTimeout
+	}
+
+	return preCheck
+}
+
+// Run returns an error if any of the configured conditions does not hold.  The
+// file tests run first, since they are cheaper than the command, which is killed
+// if it runs for longer than the timeout.
+func (p *PreCheck) Run() error {
+	if p.fileExists != "" {
+		if _, err := os.Stat(p.fileExists); err != nil {
+			return fmt.Errorf("required file is missing: %w", err)
+		}
+	}
+
+	if p.fileAbsent != "" {
+		if _, err := os.Stat(p.fileAbsent); err == nil {
+			return fmt.Errorf("file %s is present", p.fileAbsent)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if len(p.command) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		defer cancel()
+
+		//nolint:gosec // The command is taken from the operator's config
+		if err := exec.CommandContext(ctx, p.command[0], p.command[1:]...).Run(); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("command %s timed out after %s", p.command[0], p.timeout)
+			}
+
+			return fmt.Errorf("command %s failed: %w", p.command[0], err)
+		}
+	}
+
+	return nil
+}
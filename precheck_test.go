@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestNewPreCheckUnconfigured(t *testing.T) {
+	if preCheck := NewPreCheck(viper.New()); preCheck != nil {
+		t.Errorf("Expected no pre-check but received %+v.", preCheck)
+	}
+}
+
+func TestPreCheckRun(t *testing.T) {
+	dir := t.TempDir()
+
+	present := filepath.Join(dir, "present")
+	if err := os.WriteFile(present, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name     string
+		preCheck PreCheck
+		ok       bool
+	}{
+		{"file exists", PreCheck{fileExists: present}, true},
+		{"file missing", PreCheck{fileExists: missing}, false},
+		{"file absent", PreCheck{fileAbsent: missing}, true},
+		{"file present", PreCheck{fileAbsent: present}, false},
+		{"command succeeds", PreCheck{command: []string{"true"}, timeout: time.Second}, true},
+		{"command fails", PreCheck{command: []string{"false"}, timeout: time.Second}, false},
+		{"command times out", PreCheck{command: []string{"sleep", "5"}, timeout: 10 * time.Millisecond}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.preCheck.Run(); (err == nil) != test.ok {
+			t.Errorf("Expected %s to pass: %t, but received error: %v", test.name, test.ok, err)
+		}
+	}
+}
+
+func TestCheckStatusPreCheckFailed(t *testing.T) {
+	dbHandler := &DBHandler{preCheck: &PreCheck{fileExists: filepath.Join(t.TempDir(), "missing")}}
+
+	expected := CheckResult{Status: NotReady, Reason: ReasonPreCheckFailed}
+	if result := dbHandler.checkStatus(false); result != expected {
+		t.Errorf("Expected %+v but received %+v.", expected, result)
+	}
+}
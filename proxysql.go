@@ -0,0 +1,43 @@
+/*
+Proxysql.go provides routing hints in a format consumable by ProxySQL scheduler scripts.
+*/
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// proxySQLOnline is the ProxySQL server status of a node which should receive traffic.
+	proxySQLOnline = "ONLINE"
+	// proxySQLOfflineSoft is the ProxySQL server status of a node which should be drained.
+	proxySQLOfflineSoft = "OFFLINE_SOFT"
+)
+
+// ProxySQLHint advises a ProxySQL scheduler which hostgroup, status and weight to
+// assign to the node.
+type ProxySQLHint struct {
+	Hostgroup int
+	Status    string
+	Weight    int
+}
+
+// NewProxySQLHint builds the routing hint for a node in the given state.  Writable
+// nodes are routed to the writer hostgroup, read-only nodes to the reader
+// hostgroup, and any other node is taken offline in the writer hostgroup.
+func NewProxySQLHint(status ServerStatus, weight int, writerHostgroup int, readerHostgroup int) ProxySQLHint {
+	switch status {
+	case Available:
+		return ProxySQLHint{Hostgroup: writerHostgroup, Status: proxySQLOnline, Weight: weight}
+	case ReadOnly, Standby:
+		return ProxySQLHint{Hostgroup: readerHostgroup, Status: proxySQLOnline, Weight: maxWeight}
+	default:
+		return ProxySQLHint{Hostgroup: writerHostgroup, Status: proxySQLOfflineSoft, Weight: 0}
+	}
+}
+
+// String formats the hint as a single line of space-separated key=value pairs, e.g.
+// "hostgroup=10 status=ONLINE weight=100".
+func (h ProxySQLHint) String() string {
+	return fmt.Sprintf("hostgroup=%d status=%s weight=%d", h.Hostgroup, h.Status, h.Weight)
+}
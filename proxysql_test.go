@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestProxySQLHint(t *testing.T) {
+	tests := []struct {
+		status   ServerStatus
+		weight   int
+		expected string
+	}{
+		{Available, 40, "hostgroup=10 status=ONLINE weight=40"},
+		{ReadOnly, 0, "hostgroup=20 status=ONLINE weight=100"},
+		{NotReady, 0, "hostgroup=10 status=OFFLINE_SOFT weight=0"},
+		{Unavailable, 0, "hostgroup=10 status=OFFLINE_SOFT weight=0"},
+	}
+
+	for _, test := range tests {
+		hint := NewProxySQLHint(test.status, test.weight, 10, 20).String()
+		if hint != test.expected {
+			t.Errorf("Expected hint \"%s\" for status %v but received \"%s\".", test.expected, test.status, hint)
+		}
+	}
+}
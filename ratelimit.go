@@ -0,0 +1,110 @@
+/*
+Ratelimit.go provides per-source rate limiting of HTTP requests.
+*/
+package main
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterCapacity is the maximum number of sources tracked at once.  The least
+// recently seen source is forgotten when a new one arrives at capacity.
+const rateLimiterCapacity = 1024
+
+// RateLimiter limits the rate of requests per source using a token bucket for each
+// source, tracked in a bounded LRU list.
+type RateLimiter struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	capacity int
+	sources  map[string]*list.Element
+	lru      *list.List
+}
+
+// rateLimiterEntry is an element of the RateLimiter LRU list.
+type rateLimiterEntry struct {
+	source  string
+	limiter *rate.Limiter
+}
+
+// NewRateLimiter creates a RateLimiter allowing requestsPerSecond requests per
+// source, with bursts of up to burst requests.
+func NewRateLimiter(requestsPerSecond float64, burst int, capacity int) *RateLimiter {
+	instance := new(RateLimiter)
+	instance.limit = rate.Limit(requestsPerSecond)
+	instance.burst = burst
+	instance.capacity = capacity
+	instance.sources = make(map[string]*list.Element)
+	instance.lru = list.New()
+
+	return instance
+}
+
+// Allow reports whether a request from source may proceed, and if not, how long
+// the source should wait before retrying.
+func (r *RateLimiter) Allow(source string) (bool, time.Duration) {
+	reservation := r.limiterFor(source).Reserve()
+
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// limiterFor returns the limiter of source, creating it if needed and marking it
+// as the most recently used.
+func (r *RateLimiter) limiterFor(source string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.sources[source]; ok {
+		r.lru.MoveToFront(element)
+		return element.Value.(*rateLimiterEntry).limiter
+	}
+
+	if r.lru.Len() >= r.capacity {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.sources, oldest.Value.(*rateLimiterEntry).source)
+	}
+
+	entry := &rateLimiterEntry{source: source, limiter: rate.NewLimiter(r.limit, r.burst)}
+	r.sources[source] = r.lru.PushFront(entry)
+
+	return entry.limiter
+}
+
+// Middleware wraps next so requests exceeding the rate limit of their source IP
+// receive a 429 response with a Retry-After header.
+func (r *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		source, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			source = req.RemoteAddr
+		}
+
+		if ok, delay := r.Allow(source); !ok {
+			logrus.Debugf("Rate limit exceeded by %s", source)
+
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
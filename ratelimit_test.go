@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rateLimiter := NewRateLimiter(1, 1, rateLimiterCapacity)
+
+	if ok, _ := rateLimiter.Allow("10.0.0.1"); !ok {
+		t.Error("Expected first request to be allowed.")
+	}
+
+	if ok, delay := rateLimiter.Allow("10.0.0.1"); ok || delay <= 0 {
+		t.Errorf("Expected second request to be limited with a delay but received %t and %s.", ok, delay)
+	}
+
+	if ok, _ := rateLimiter.Allow("10.0.0.2"); !ok {
+		t.Error("Expected request from another source to be allowed.")
+	}
+}
+
+func TestRateLimiterCapacity(t *testing.T) {
+	rateLimiter := NewRateLimiter(1, 1, 2)
+
+	rateLimiter.Allow("10.0.0.1")
+	rateLimiter.Allow("10.0.0.2")
+	rateLimiter.Allow("10.0.0.3")
+
+	if len(rateLimiter.sources) != 2 || rateLimiter.lru.Len() != 2 {
+		t.Errorf("Expected 2 tracked sources but found %d.", len(rateLimiter.sources))
+	}
+
+	if _, ok := rateLimiter.sources["10.0.0.1"]; ok {
+		t.Error("Expected least recently used source to be evicted.")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	handler := NewRateLimiter(1, 1, rateLimiterCapacity).Middleware(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {}))
+
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != expected {
+			t.Errorf("Expected status code %d for request %d but received %d.", expected, i+1, recorder.Code)
+		}
+
+		if expected == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") != "1" {
+			t.Errorf("Expected Retry-After of 1 second but received \"%s\".", recorder.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Resultwindow.go smooths health check results by majority over recent checks.
+*/
+package main
+
+import "sync"
+
+// ResultWindow keeps the results of the most recent health checks in a ring buffer
+// of fixed size, and reports the most frequent of them.
+type ResultWindow struct {
+	mu      sync.Mutex
+	results []CheckResult
+	next    int
+	full    bool
+}
+
+// NewResultWindow creates a ResultWindow voting over up to size results, or
+// returns nil if size does not allow more than one result.
+func NewResultWindow(size int) *ResultWindow {
+	if size <= 1 {
+		return nil
+	}
+
+	return &ResultWindow{results: make([]CheckResult, size)}
+}
+
+// Apply records result, replacing the oldest one if the window is full, and
+// returns the most frequent result in the window.  A tie is won by the result
+// seen most recently, so the window follows a change once it is no longer
+// outnumbered.
+func (w *ResultWindow) Apply(result CheckResult) CheckResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.results[w.next] = result
+	w.next = (w.next + 1) % len(w.results)
+
+	if w.next == 0 {
+		w.full = true
+	}
+
+	count := w.next
+	if w.full {
+		count = len(w.results)
+	}
+
+	votes := make(map[CheckResult]int, count)
+	for _, candidate := range w.results[:count] {
+		votes[candidate]++
+	}
+
+	majority := result
+
+	// Walk from the latest result backwards, so earlier results only win with
+	// strictly more votes.
+	for i := 2; i <= count; i++ {
+		candidate := w.results[(w.next-i+len(w.results))%len(w.results)]
+		if votes[candidate] > votes[majority] {
+			majority = candidate
+		}
+	}
+
+	return majority
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestNewResultWindowDisabled(t *testing.T) {
+	for _, size := range []int{0, 1} {
+		if window := NewResultWindow(size); window != nil {
+			t.Errorf("Expected no result window for size %d.", size)
+		}
+	}
+}
+
+func TestResultWindowApply(t *testing.T) {
+	available := CheckResult{Status: Available}
+	notReady := CheckResult{Status: NotReady, Reason: ReasonWsrepNotReady}
+	unavailable := CheckResult{Status: Unavailable}
+
+	tests := []struct {
+		result   CheckResult
+		expected CheckResult
+	}{
+		{available, available},
+		{notReady, notReady}, // Tie, the latest result wins.
+		{available, available},
+		{unavailable, available},
+		{notReady, notReady}, // The first result dropped out of the window.
+		{unavailable, unavailable},
+	}
+
+	window := NewResultWindow(4)
+
+	for i, test := range tests {
+		if result := window.Apply(test.result); result != test.expected {
+			t.Errorf("Expected %+v after check %d but received %+v.", test.expected, i+1, result)
+		}
+	}
+}
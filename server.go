@@ -1,21 +1,102 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"mime"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // HTTPServerHandler encapsulates all required objects to manage an HTTP server instance.
 type HTTPServerHandler struct {
 	config    *viper.Viper
 	dbHandler *DBHandler
-	server    *http.Server
+	metrics   *Metrics
+	servers   []*http.Server
+	grpc      *GRPCHealthServer
+	audit     *AuditLogger
+	statsd    *StatsDClient
+	tally     *ResultTally
+	tlsConfig *tls.Config
+
+	// ports holds the handlers of the additional instances in connection.ports.
+	ports map[int]*DBHandler
+
+	// shared holds the sockets set with UseListeners, which outlive the server.
+	shared []*sharedListener
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// healthProbe selects what a health check endpoint verifies.
+type healthProbe int
+
+const (
+	// readinessProbe runs the full health check, for whether the node should receive traffic.
+	readinessProbe healthProbe = iota
+	// livenessProbe only verifies the connection to the database server, for
+	// whether the node should be restarted.
+	livenessProbe
+)
+
+// livenessMessage is the response of a passing liveness probe.
+const livenessMessage = "MySQL cluster node is alive."
+
+const (
+	// responseModeDefault answers failing health checks with 503.
+	responseModeDefault = "default"
+	// responseModeConsul answers read-only nodes with 429, the warning state of
+	// Consul HTTP checks, and other failing health checks with 503.
+	responseModeConsul = "consul"
+)
+
+// Networks of http.network, restricting the HTTP server to IPv4 or IPv6.
+const (
+	networkDual = "tcp"
+	networkIPv4 = "tcp4"
+	networkIPv6 = "tcp6"
+)
+
+// strictHeader is the request header asking for a strict health check, which
+// disregards the options tolerating donor, joined or read-only nodes.
+const strictHeader = "X-Healthcheck-Strict"
+
+// healthResponse is the body of a health check response in JSON format.
+type healthResponse struct {
+	Status  string       `json:"status"`
+	Ready   bool         `json:"ready"`
+	Message string       `json:"message"`
+	Cluster *ClusterInfo `json:"cluster,omitempty"`
+
+	CheckedAt string     `json:"checked_at,omitempty"`
+	LastError *LastError `json:"last_error,omitempty"`
+
+	// CustomQueryDuration is the duration of the last run of customQuery in seconds.
+	CustomQueryDuration *float64 `json:"custom_query_duration_seconds,omitempty"`
+}
+
+// clusterHealthResponse is the body of a cluster health response in JSON format.
+type clusterHealthResponse struct {
+	Healthy bool         `json:"healthy"`
+	Message string       `json:"message"`
+	Cluster *ClusterInfo `json:"cluster,omitempty"`
 }
 
 // NewHTTPServerHandler creates a new HTTPServerHandler with the supplied config and dbHandlers.
@@ -23,13 +104,360 @@ func NewHTTPServerHandler(config *viper.Viper, dbHandler *DBHandler) *HTTPServer
 	instance := new(HTTPServerHandler)
 	instance.config = config
 	instance.dbHandler = dbHandler
+	instance.metrics = NewMetrics(config)
+
+	if latencies := dbHandler.Latencies(); latencies != nil {
+		instance.metrics.RegisterLatencies(latencies)
+	}
+
+	if certExpiry := dbHandler.CertExpiry(); certExpiry != nil {
+		instance.metrics.RegisterCertExpiry(certExpiry)
+	}
+
+	if config.GetBool("audit.enabled") {
+		auditLogger, err := NewAuditLogger(config.GetString("audit.output"))
+		if err != nil {
+			logrus.Fatalf("Error opening audit output: %v", err)
+		}
+
+		instance.audit = auditLogger
+	}
+
+	if config.GetBool("http.include_last_error") && !privilegedAccessEnabled(config) {
+		logrus.Warn("http.include_last_error is ignored since neither http.auth nor http.admin_token is set")
+	}
+
+	switch responseMode := config.GetString("http.response_mode"); responseMode {
+	case "", responseModeDefault, responseModeConsul:
+	default:
+		logrus.Errorf("Unknown http.response_mode %q, using %q", responseMode, responseModeDefault)
+		config.Set("http.response_mode", responseModeDefault)
+	}
+
+	if config.IsSet("http.auth.username") != config.IsSet("http.auth.password") {
+		logrus.Warn("http.auth is ignored since only one of http.auth.username and http.auth.password is set")
+	}
+
+	if code := config.GetInt("http.standby_status_code"); code != 0 && (code < 200 || code > 599) {
+		logrus.Errorf("Invalid http.standby_status_code %d, using %d", code, http.StatusOK)
+		config.Set("http.standby_status_code", http.StatusOK)
+	}
+
+	switch network := config.GetString("http.network"); network {
+	case "", networkDual, networkIPv4, networkIPv6:
+	default:
+		logrus.Errorf("Unknown http.network %q, using %q", network, networkDual)
+		config.Set("http.network", networkDual)
+	}
+
+	for _, key := range []string{"http.detail_path", "http.status_path"} {
+		if config.IsSet(key) && !privilegedAccessEnabled(config) {
+			logrus.Warnf("%s rejects all requests since neither http.auth nor http.admin_token is set", key)
+		}
+	}
+
+	if config.GetBool("http.allow_header_overrides") && !privilegedAccessEnabled(config) {
+		logrus.Warn("http.allow_header_overrides is ignored since neither http.auth nor http.admin_token is set")
+	}
+
+	if certFile, keyFile := config.GetString("http.tls.cert"), config.GetString("http.tls.key"); certFile != "" ||
+		keyFile != "" {
+		tlsConfig, err := newServerTLSConfig(certFile, keyFile)
+		if err != nil {
+			logrus.Fatalf("Error loading the HTTP server certificate: %v", err)
+		}
+
+		instance.tlsConfig = tlsConfig
+	}
+
+	if config.GetBool("statsd.enabled") {
+		statsdClient, err := NewStatsDClient(config)
+		if err != nil {
+			logrus.Fatalf("Error opening StatsD socket: %v", err)
+		}
+
+		instance.statsd = statsdClient
+	}
+
+	if config.IsSet("grpc.port") {
+		instance.grpc = NewGRPCHealthServer(config, dbHandler)
+	}
 
 	return instance
 }
 
-// StartServer creates and configures a new instance of an HTTP server to handle health check requests.
+// newServerTLSConfig returns the TLS configuration serving the certificate and key
+// of http.tls, failing if either is missing or they do not form a valid pair.
+func newServerTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both http.tls.cert and http.tls.key must be set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// SetResultTally counts the health check results served in tally, for the
+// shutdown summary of the daemon.  It must be called before StartServer.
+func (s *HTTPServerHandler) SetResultTally(tally *ResultTally) {
+	s.tally = tally
+}
+
+// AddPort serves health checks of the instance at port of connection.host with
+// dbHandler, at the port number below http.path.  It must be called before
+// StartServer.
+func (s *HTTPServerHandler) AddPort(port int, dbHandler *DBHandler) {
+	if s.ports == nil {
+		s.ports = make(map[int]*DBHandler)
+	}
+
+	s.ports[port] = dbHandler
+}
+
+// portHealthCheckPath returns the URI path of the health check of port below basePath,
+// e.g. /health/3307.
+func portHealthCheckPath(basePath string, port int) string {
+	return strings.TrimSuffix(basePath, "/") + "/" + strconv.Itoa(port)
+}
+
+// listenSockets returns the sockets to serve HTTP on, one per address of http.addr.
+// An address holding a port is used as is, others listen on http.port.
+func (s *HTTPServerHandler) listenSockets() []string {
+	var sockets []string
+
+	for _, addr := range s.config.GetStringSlice("http.addr") {
+		if _, _, err := net.SplitHostPort(addr); err == nil {
+			sockets = append(sockets, addr)
+		} else {
+			sockets = append(sockets, net.JoinHostPort(addr, s.config.GetString("http.port")))
+		}
+	}
+
+	return sockets
+}
+
+// listen opens the sockets to serve HTTP on: the Unix socket at http.unix_socket if
+// set, or otherwise one TCP socket per address of http.addr.
+func (s *HTTPServerHandler) listen() []net.Listener {
+	if path := s.config.GetString("http.unix_socket"); path != "" {
+		return []net.Listener{s.listenUnix(path)}
+	}
+
+	network := s.config.GetString("http.network")
+	if network == "" {
+		network = networkDual
+	}
+
+	var listeners []net.Listener
+
+	for _, socket := range s.listenSockets() {
+		listener, err := net.Listen(network, socket)
+		if err != nil {
+			logrus.Fatalf("Error opening HTTP socket: %v", err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners
+}
+
+// listenUnix opens the Unix socket at path, replacing a stale socket file left by
+// a previous run, and applies http.socket_mode to it if set.
+func (s *HTTPServerHandler) listenUnix(path string) net.Listener {
+	if err := removeStaleSocket(path); err != nil {
+		logrus.Fatalf("Error removing stale HTTP socket file: %v", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		logrus.Fatalf("Error opening HTTP socket: %v", err)
+	}
+
+	if socketMode := s.config.GetString("http.socket_mode"); socketMode != "" {
+		mode, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil {
+			logrus.Fatalf("Invalid http.socket_mode %q: %v", socketMode, err)
+		}
+
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			logrus.Fatalf("Error setting the mode of the HTTP socket file: %v", err)
+		}
+	}
+
+	return listener
+}
+
+// removeStaleSocket removes the socket file at path, if any.  Any other kind of
+// file is left in place and reported as an error, so a mistyped http.unix_socket
+// cannot delete unrelated data.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case info.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
+
+// deadlineListener is a listener whose pending Accept can be interrupted with a
+// deadline, as TCP and Unix listeners can.
+type deadlineListener interface {
+	net.Listener
+	SetDeadline(t time.Time) error
+}
+
+// sharedListener is a socket kept open across reloads, which the HTTP servers of
+// successive configs serve in turn.  Closing it only interrupts the Accept of the
+// server shutting down, so connections arriving during a reload queue on the socket
+// until the next server takes over, rather than being refused.
+type sharedListener struct {
+	deadlineListener
+}
+
+// Close interrupts the pending Accept, leaving the socket open.
+func (l *sharedListener) Close() error {
+	return l.SetDeadline(time.Unix(1, 0))
+}
+
+// resume lets the next server accept connections on the socket again.
+func (l *sharedListener) resume() error {
+	return l.SetDeadline(time.Time{})
+}
+
+// release closes the socket for good, which also removes the file of a Unix socket.
+func (l *sharedListener) release() error {
+	return l.deadlineListener.Close()
+}
+
+// listenShared opens the sockets to serve HTTP on, like listen, so they can be kept
+// open across reloads with UseListeners.
+func (s *HTTPServerHandler) listenShared() []*sharedListener {
+	var shared []*sharedListener
+
+	for _, listener := range s.listen() {
+		shared = append(shared, &sharedListener{deadlineListener: listener.(deadlineListener)})
+	}
+
+	return shared
+}
+
+// UseListeners serves HTTP on listeners, which were opened by a previous server,
+// instead of opening new sockets.  The listeners are left open when the server
+// stops.  It must be called before StartServer.
+func (s *HTTPServerHandler) UseListeners(listeners []*sharedListener) {
+	s.shared = listeners
+}
+
+// StartServer creates and configures a new instance of an HTTP server per address of
+// http.addr to handle health check requests, and blocks until all of them are stopped.
 func (s *HTTPServerHandler) StartServer() {
-	socket := net.JoinHostPort(s.config.GetString("http.addr"), s.config.GetString("http.port"))
+	var handler http.Handler = s.newRouter()
+
+	if rateLimit := s.config.GetFloat64("http.rate_limit"); rateLimit > 0 {
+		logrus.Debugf("Limiting requests to %v per second per source", rateLimit)
+		handler = NewRateLimiter(rateLimit, s.config.GetInt("http.rate_limit_burst"), rateLimiterCapacity).
+			Middleware(handler)
+	}
+
+	if s.config.GetBool("http.enable_h2c") {
+		logrus.Debug("Accepting cleartext HTTP/2 (h2c) requests")
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	var listeners []net.Listener
+
+	if s.shared != nil {
+		for _, listener := range s.shared {
+			if err := listener.resume(); err != nil {
+				logrus.Fatalf("Error resuming HTTP socket: %v", err)
+			}
+
+			listeners = append(listeners, listener)
+		}
+	} else {
+		listeners = s.listen()
+	}
+
+	var servers []*http.Server
+
+	// Each server gets its own TLS config, since ServeTLS adds the HTTP/2 protocol
+	// to the config it is given.
+	for _, listener := range listeners {
+		servers = append(servers, &http.Server{
+			Addr:              listener.Addr().String(),
+			Handler:           handler,
+			TLSConfig:         s.tlsConfig.Clone(),
+			ReadTimeout:       1 * time.Second,
+			WriteTimeout:      1 * time.Second,
+			IdleTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 2 * time.Second,
+		})
+	}
+
+	// StopServer may be called from another goroutine before we get here.
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+
+		for _, listener := range listeners {
+			listener.Close()
+		}
+
+		logrus.Info("HTTP server stopped before starting.")
+
+		return
+	}
+	s.servers = servers
+	s.mu.Unlock()
+
+	if s.grpc != nil {
+		go s.grpc.StartServer()
+	}
+
+	var wg sync.WaitGroup
+
+	for i, server := range servers {
+		if s.tlsConfig != nil {
+			logrus.Infof("Starting HTTPS server on %s.", listeners[i].Addr())
+		} else {
+			logrus.Infof("Starting HTTP server on %s.", listeners[i].Addr())
+		}
+
+		wg.Add(1)
+
+		go func(server *http.Server, listener net.Listener) {
+			defer wg.Done()
+
+			var err error
+			if s.tlsConfig != nil {
+				// The certificate is already loaded into server.TLSConfig.
+				err = server.ServeTLS(listener, "", "")
+			} else {
+				err = server.Serve(listener)
+			}
+
+			if !errors.Is(err, http.ErrServerClosed) {
+				logrus.Fatalf("Error serving HTTP: %v", err)
+			}
+		}(server, listeners[i])
+	}
+
+	wg.Wait()
+}
+
+// newRouter registers the handlers of all configured endpoints.
+func (s *HTTPServerHandler) newRouter() *http.ServeMux {
 	path := s.config.GetString("http.path")
 
 	logrus.Debugf("Registering health check endpoint at URI path %s", path)
@@ -37,51 +465,806 @@ func (s *HTTPServerHandler) StartServer() {
 	router := http.NewServeMux()
 	router.HandleFunc(path, s.serveHTTPHealthCheck)
 
-	s.server = &http.Server{
-		Addr:              socket,
-		Handler:           router,
-		ReadTimeout:       1 * time.Second,
-		WriteTimeout:      1 * time.Second,
-		IdleTimeout:       30 * time.Second,
-		ReadHeaderTimeout: 2 * time.Second,
+	if s.config.GetBool("http.format_from_extension") {
+		logrus.Debugf("Registering health check endpoints at URI paths %s.json and %s.txt", path, path)
+		router.HandleFunc(path+".json", s.serveHTTPHealthCheck)
+		router.HandleFunc(path+".txt", s.serveHTTPHealthCheck)
 	}
 
-	logrus.Info("Starting HTTP server.")
+	if s.config.IsSet("http.liveness_path") {
+		livenessPath := s.config.GetString("http.liveness_path")
+		logrus.Debugf("Registering liveness endpoint at URI path %s", livenessPath)
+		router.HandleFunc(livenessPath, s.serveHTTPLiveness)
+	}
 
-	if err := s.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-		logrus.Fatalf("Error opening HTTP socket: %v", err)
+	if s.config.IsSet("http.readiness_path") {
+		readinessPath := s.config.GetString("http.readiness_path")
+		logrus.Debugf("Registering readiness endpoint at URI path %s", readinessPath)
+		router.HandleFunc(readinessPath, s.serveHTTPReadiness)
+	}
+
+	if s.config.IsSet("http.weight_path") {
+		weightPath := s.config.GetString("http.weight_path")
+		logrus.Debugf("Registering weight endpoint at URI path %s", weightPath)
+		router.HandleFunc(weightPath, s.serveHTTPWeight)
+	}
+
+	if s.config.IsSet("http.wsrep_state_path") {
+		wsrepStatePath := s.config.GetString("http.wsrep_state_path")
+		logrus.Debugf("Registering wsrep state endpoint at URI path %s", wsrepStatePath)
+		router.HandleFunc(wsrepStatePath, s.serveHTTPWsrepState)
+	}
+
+	if s.config.IsSet("http.proxysql_path") {
+		proxySQLPath := s.config.GetString("http.proxysql_path")
+		logrus.Debugf("Registering ProxySQL hint endpoint at URI path %s", proxySQLPath)
+		router.HandleFunc(proxySQLPath, s.serveHTTPProxySQLHint)
+	}
+
+	if s.config.IsSet("http.metrics_path") {
+		metricsPath := s.config.GetString("http.metrics_path")
+		logrus.Debugf("Registering metrics endpoint at URI path %s", metricsPath)
+		router.Handle(metricsPath, s.metrics.Handler())
+	}
+
+	if s.config.IsSet("http.cluster_path") {
+		clusterPath := s.config.GetString("http.cluster_path")
+		logrus.Debugf("Registering cluster health endpoint at URI path %s", clusterPath)
+		router.HandleFunc(clusterPath, s.serveHTTPClusterHealth)
+	}
+
+	if s.config.IsSet("http.detail_path") {
+		detailPath := s.config.GetString("http.detail_path")
+		logrus.Debugf("Registering detailed status endpoint at URI path %s", detailPath)
+		router.HandleFunc(detailPath, s.serveHTTPDetail)
 	}
+
+	if s.config.IsSet("http.status_path") {
+		statusPath := s.config.GetString("http.status_path")
+		logrus.Debugf("Registering diagnostics endpoint at URI path %s", statusPath)
+		router.HandleFunc(statusPath, s.serveHTTPDiagnostics)
+	}
+
+	if s.config.IsSet("http.stats_path") {
+		statsPath := s.config.GetString("http.stats_path")
+		logrus.Debugf("Registering stats endpoint at URI path %s", statsPath)
+		router.HandleFunc(statsPath, s.serveHTTPStats)
+	}
+
+	for port, dbHandler := range s.ports {
+		portPath := portHealthCheckPath(path, port)
+		logrus.Debugf("Registering health check endpoint for port %d at URI path %s", port, portPath)
+		router.HandleFunc(portPath, s.serveHTTPPort(portPath, dbHandler))
+	}
+
+	return router
 }
 
 // StopServer signals to the running HTTP server to complete existing requests and shut down gracefully.
+// It is safe to call more than once, and before StartServer, which then returns immediately.
 func (s *HTTPServerHandler) StopServer() {
-	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
-	defer cancel()
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	servers := s.servers
+	s.mu.Unlock()
 
-	s.server.SetKeepAlivesEnabled(false)
+	if len(servers) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+		defer cancel()
 
-	if err := s.server.Shutdown(ctx); err != nil {
-		logrus.Fatalf("Could not gracefully shutdown the HTTP server: %v", err)
+		for _, server := range servers {
+			server.SetKeepAlivesEnabled(false)
+
+			if err := server.Shutdown(ctx); err != nil {
+				logrus.Fatalf("Could not gracefully shutdown the HTTP server on %s: %v", server.Addr, err)
+			}
+		}
+
+		logrus.Info("HTTP server stopped.")
 	}
 
-	logrus.Info("HTTP server stopped.")
+	if path := s.config.GetString("http.unix_socket"); path != "" && len(servers) > 0 && s.shared == nil {
+		// Closing the listener normally unlinks the socket file already.
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.Errorf("Error removing HTTP socket file: %v", err)
+		}
+	}
+
+	if s.grpc != nil {
+		s.grpc.StopServer()
+	}
+
+	if s.audit != nil {
+		if err := s.audit.Close(); err != nil {
+			logrus.Errorf("Error closing audit output: %v", err)
+		}
+	}
+
+	if s.statsd != nil {
+		if err := s.statsd.Close(); err != nil {
+			logrus.Errorf("Error closing StatsD socket: %v", err)
+		}
+	}
 }
 
 func (s *HTTPServerHandler) serveHTTPHealthCheck(w http.ResponseWriter, req *http.Request) {
-	if req.URL.Path != s.config.GetString("http.path") {
+	format, ok := s.healthCheckFormat(req)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	s.serveProbe(w, req, s.dbHandler, readinessProbe, format)
+}
+
+// serveHTTPLiveness responds with whether the connection to the database server
+// works, regardless of the state of the node.
+func (s *HTTPServerHandler) serveHTTPLiveness(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.liveness_path") {
 		http.NotFound(w, req)
 		return
 	}
 
+	s.serveProbe(w, req, s.dbHandler, livenessProbe, s.responseFormat(req))
+}
+
+// serveHTTPReadiness responds with the result of the full health check, like http.path.
+func (s *HTTPServerHandler) serveHTTPReadiness(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.readiness_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	s.serveProbe(w, req, s.dbHandler, readinessProbe, s.responseFormat(req))
+}
+
+// serveHTTPPort returns the handler of the health check of an additional instance
+// in connection.ports, served at portPath.
+func (s *HTTPServerHandler) serveHTTPPort(portPath string, dbHandler *DBHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != portPath {
+			http.NotFound(w, req)
+			return
+		}
+
+		s.serveProbe(w, req, dbHandler, readinessProbe, s.responseFormat(req))
+	}
+}
+
+// serveProbe runs probe against dbHandler and writes its result in the given
+// format.  Only readiness probes of the main instance without overrides are
+// recorded in metrics, StatsD and the audit trail, since a node which is merely
+// alive says nothing about whether it should receive traffic, and the metrics
+// describe a single instance under its configured policy.
+func (s *HTTPServerHandler) serveProbe(w http.ResponseWriter, req *http.Request, dbHandler *DBHandler,
+	probe healthProbe, format string) {
 	logrus.Debugf("Processing health check request from %s", req.RemoteAddr)
-	w.Header().Add("Connection", "close")
+	s.setConnectionHeader(w)
 
-	ready, msg := RunStatusCheck(s.dbHandler)
-	if !ready {
-		w.WriteHeader(http.StatusServiceUnavailable)
+	if !isLoopbackRequest(req) && !s.basicAuthorized(req) {
+		logrus.Debugf("Rejecting unauthorized health check request from %s", req.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+AppName+`"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	var result CheckResult
+
+	if probe == livenessProbe {
+		result = CheckResult{Status: Unavailable}
+		if dbHandler.isConnected() {
+			result.Status = Available
+		}
+	} else if s.strictRequested(req) {
+		logrus.Debugf("Running strict health check requested by %s", req.RemoteAddr)
+		result = dbHandler.GetStrictStatus()
+	} else {
+		start := time.Now()
+
+		var coldStart bool
+		result, coldStart = dbHandler.getStatus()
+
+		if dbHandler == s.dbHandler {
+			s.observeResult(req, result, time.Since(start), coldStart)
+		}
+	}
+
+	msg := statusMessage(result)
+	if probe == livenessProbe && result.Status == Available {
+		msg = livenessMessage
+	}
+
+	ready := result.Status == Available
+
+	var lastError *LastError
+	if !ready && s.lastErrorAuthorized(req) {
+		lastError = dbHandler.LastError()
+	}
+
+	if format == "json" {
+		s.writeJSONHealthCheck(w, dbHandler, result, msg, lastError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if code := s.statusCode(result); code != http.StatusOK {
+		w.WriteHeader(code)
+	}
+
+	if lastError != nil {
+		msg += fmt.Sprintf("\nLast error (%d): %s", lastError.Number, lastError.Message)
 	}
 
 	if _, err := w.Write([]byte(msg)); err != nil {
 		logrus.Errorf("Error writing data to HTTP response: %v", err)
 	}
 }
+
+// observeResult records the result of a health check requested by req in the
+// metrics, and in StatsD, the audit trail and the shutdown summary if enabled.
+// The duration of a cold-start check is recorded apart from that of other checks.
+func (s *HTTPServerHandler) observeResult(req *http.Request, result CheckResult, duration time.Duration,
+	coldStart bool) {
+	s.metrics.ObserveResult(result, duration, coldStart)
+
+	if s.tally != nil {
+		s.tally.Observe(result)
+	}
+
+	if s.statsd != nil {
+		wsrepState, wsrepKnown := s.dbHandler.WsrepState()
+		if err := s.statsd.ObserveCheck(result, duration, coldStart, wsrepState, wsrepKnown); err != nil {
+			logrus.Debugf("Error sending StatsD metrics: %v", err)
+		}
+	}
+
+	if s.audit != nil {
+		if err := s.audit.Record(req.RemoteAddr, result); err != nil {
+			logrus.Errorf("Error writing audit record: %v", err)
+		}
+	}
+}
+
+// statusCode returns the HTTP status code of a health check response with result.
+// Available nodes get 200 and all others 503, except in the consul
+// http.response_mode, where read-only nodes get 429, which Consul treats as a
+// warning rather than critical.
+func (s *HTTPServerHandler) statusCode(result CheckResult) int {
+	switch {
+	case result.Status == Available:
+		return http.StatusOK
+	case result.Status == ReadOnly && s.config.GetString("http.response_mode") == responseModeConsul:
+		return http.StatusTooManyRequests
+	case result.Status == Standby:
+		if code := s.config.GetInt("http.standby_status_code"); code != 0 {
+			return code
+		}
+
+		return http.StatusOK
+	}
+
+	return http.StatusServiceUnavailable
+}
+
+// healthCheckFormat returns the response format of the health check request req,
+// or false if its path is not a health check endpoint.  With
+// http.format_from_extension, a ".json" or ".txt" extension on http.path selects
+// the format, and http.path itself is answered as per responseFormat.
+func (s *HTTPServerHandler) healthCheckFormat(req *http.Request) (string, bool) {
+	path, basePath := req.URL.Path, s.config.GetString("http.path")
+
+	switch {
+	case path == basePath:
+		return s.responseFormat(req), true
+	case !s.config.GetBool("http.format_from_extension"):
+		return "", false
+	case path == basePath+".json":
+		return "json", true
+	case path == basePath+".txt":
+		return "text", true
+	}
+
+	return "", false
+}
+
+// responseFormat returns the format to answer req in, which is JSON if its Accept
+// header asks for application/json, and http.response_format otherwise.
+func (s *HTTPServerHandler) responseFormat(req *http.Request) string {
+	if acceptsJSON(req.Header.Get("Accept")) {
+		return "json"
+	}
+
+	return s.config.GetString("http.response_format")
+}
+
+// acceptsJSON reports whether the Accept header value accept lists application/json
+// with a non-zero quality.  Wildcards are not taken as a request for JSON, so
+// clients sending */* keep receiving the configured format.
+func acceptsJSON(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// lastErrorAuthorized reports whether the last database error may be included in
+// the response to req, which requires http.include_last_error and privileged
+// access, since error details can leak the database topology.
+func (s *HTTPServerHandler) lastErrorAuthorized(req *http.Request) bool {
+	return s.config.GetBool("http.include_last_error") && s.privilegedAuthorized(req)
+}
+
+// strictRequested reports whether req asks for a strict health check with the
+// strictHeader, which is only honored with http.allow_header_overrides and
+// privileged access, so untrusted clients cannot make a node look unhealthy to
+// its balancer.
+func (s *HTTPServerHandler) strictRequested(req *http.Request) bool {
+	value := req.Header.Get(strictHeader)
+	if value == "" {
+		return false
+	}
+
+	if !s.config.GetBool("http.allow_header_overrides") || !s.privilegedAuthorized(req) {
+		logrus.Debugf("Ignoring unauthorized %s header from %s", strictHeader, req.RemoteAddr)
+		return false
+	}
+
+	strict, err := strconv.ParseBool(value)
+	if err != nil {
+		logrus.Debugf("Ignoring invalid %s header %q from %s", strictHeader, value, req.RemoteAddr)
+		return false
+	}
+
+	return strict
+}
+
+// basicAuthorized returns whether req may run a health check.  If both
+// http.auth.username and http.auth.password are set, req must hold them as HTTP
+// Basic Auth credentials, otherwise every request is authorized.
+func (s *HTTPServerHandler) basicAuthorized(req *http.Request) bool {
+	if !basicAuthEnabled(s.config) {
+		return true
+	}
+
+	username, password := s.config.GetString("http.auth.username"), s.config.GetString("http.auth.password")
+
+	reqUsername, reqPassword, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	// Both credentials are compared, so the time taken does not tell which one is wrong.
+	usernameMatch := subtle.ConstantTimeCompare([]byte(reqUsername), []byte(username))
+	passwordMatch := subtle.ConstantTimeCompare([]byte(reqPassword), []byte(password))
+
+	return usernameMatch&passwordMatch == 1
+}
+
+// isLoopbackRequest reports whether req was received from a loopback address.
+// Health checks from the node itself need no Basic Auth credentials, since only
+// probes over the network were meant to be guarded, but privileged access still
+// requires them.
+func isLoopbackRequest(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// basicAuthEnabled returns whether both http.auth.username and http.auth.password
+// are set in config, enabling HTTP Basic Auth.
+func basicAuthEnabled(config *viper.Viper) bool {
+	return config.GetString("http.auth.username") != "" && config.GetString("http.auth.password") != ""
+}
+
+// privilegedAuthorized returns whether req may use the privileged features: the
+// last database error, strict overrides, the detailed status and the
+// diagnostics.  It requires the HTTP Basic Auth credentials if http.auth is set,
+// or else http.admin_token as a bearer token, so they are never served without
+// auth.
+func (s *HTTPServerHandler) privilegedAuthorized(req *http.Request) bool {
+	if basicAuthEnabled(s.config) {
+		return s.basicAuthorized(req)
+	}
+
+	return bearerAuthorized(req, s.config.GetString("http.admin_token"))
+}
+
+// privilegedAccessEnabled returns whether config sets a credential for the
+// privileged features, either http.auth or http.admin_token.
+func privilegedAccessEnabled(config *viper.Viper) bool {
+	return basicAuthEnabled(config) || config.GetString("http.admin_token") != ""
+}
+
+// serveHTTPDetail serves the complete status of the node as JSON, for debugging.
+func (s *HTTPServerHandler) serveHTTPDetail(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.detail_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing detailed status request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	if !s.privilegedAuthorized(req) {
+		logrus.Debugf("Rejecting unauthorized detailed status request from %s", req.RemoteAddr)
+
+		if basicAuthEnabled(s.config) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+AppName+`"`)
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	body, err := s.marshalJSON(s.dbHandler.GetStatusDetailed())
+	if err != nil {
+		logrus.Errorf("Error encoding JSON response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(body); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// serveHTTPDiagnostics serves the detailed status of the node along with the
+// resolved config, with its secrets redacted, as JSON.  It requires the same auth
+// as the detailed status.
+func (s *HTTPServerHandler) serveHTTPDiagnostics(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.status_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing diagnostics request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	if !s.privilegedAuthorized(req) {
+		logrus.Debugf("Rejecting unauthorized diagnostics request from %s", req.RemoteAddr)
+
+		if basicAuthEnabled(s.config) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+AppName+`"`)
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	diagnostics := s.dbHandler.getDiagnostics()
+	diagnostics.Config = redactedConfig(s.config)
+
+	body, err := s.marshalDiagnostics(diagnostics)
+	if err != nil {
+		logrus.Errorf("Error encoding JSON response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(body); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// marshalDiagnostics encodes the detailed status of diagnostics as marshalJSON does,
+// and adds its config under the config key.  Config keys are kept verbatim
+// regardless of http.json_key_style, so they match the config file.
+func (s *HTTPServerHandler) marshalDiagnostics(diagnostics *Diagnostics) ([]byte, error) {
+	detail, err := s.marshalJSON(diagnostics.Detail)
+	if err != nil {
+		return nil, err
+	}
+
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(detail, &response); err != nil {
+		return nil, err
+	}
+
+	if response["config"], err = json.Marshal(diagnostics.Config); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(response)
+}
+
+// bearerAuthorized reports whether req holds token as a bearer token in its
+// Authorization header.  No request is authorized if token is empty.
+func bearerAuthorized(req *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// writeJSONHealthCheck writes the health check result of dbHandler and msg as a
+// JSON object, along with the last database error if one is given.
+func (s *HTTPServerHandler) writeJSONHealthCheck(w http.ResponseWriter, dbHandler *DBHandler, result CheckResult,
+	msg string, lastError *LastError) {
+	response := healthResponse{
+		Status:    result.Status.String(),
+		Ready:     result.Status == Available,
+		Message:   msg,
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+		LastError: lastError,
+	}
+
+	if duration, ok := dbHandler.CustomQueryDuration(); ok {
+		seconds := duration.Seconds()
+		response.CustomQueryDuration = &seconds
+	}
+
+	if s.config.GetBool("http.include_cluster_info") {
+		ctx, cancel := dbHandler.newCheckContext()
+		clusterInfo, err := dbHandler.GetClusterInfo(ctx)
+
+		cancel()
+
+		if err != nil {
+			logrus.Errorf("Error reading cluster info: %v", err)
+		} else {
+			response.Cluster = clusterInfo
+		}
+	}
+
+	body, err := s.marshalJSON(response)
+	if err != nil {
+		logrus.Errorf("Error encoding JSON response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if code := s.statusCode(result); code != http.StatusOK {
+		w.WriteHeader(code)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// serveHTTPWeight responds with the current routing weight of the node as a bare
+// integer between 0 and 100.
+func (s *HTTPServerHandler) serveHTTPWeight(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.weight_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing weight request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	weight := s.dbHandler.Weight(s.dbHandler.GetStatus().Status)
+	if weight == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if _, err := w.Write([]byte(strconv.Itoa(weight))); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// serveHTTPWsrepState responds with the raw numeric wsrep_local_state of the node,
+// or -1 if it could not be queried.
+func (s *HTTPServerHandler) serveHTTPWsrepState(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.wsrep_state_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing wsrep state request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	state, err := s.dbHandler.getWsrepLocalState(req.Context())
+	if err != nil {
+		state = -1
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if _, err := w.Write([]byte(strconv.Itoa(int(state)))); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// serveHTTPProxySQLHint responds with a single-line routing hint for ProxySQL
+// scheduler scripts.  The response code is always 200 since the node's state is
+// conveyed in the hint itself.
+func (s *HTTPServerHandler) serveHTTPProxySQLHint(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.proxysql_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing ProxySQL hint request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	status := s.dbHandler.GetStatus().Status
+	hint := NewProxySQLHint(status, s.dbHandler.Weight(status),
+		s.config.GetInt("proxysql.writer_hostgroup"), s.config.GetInt("proxysql.reader_hostgroup"))
+
+	if _, err := w.Write([]byte(hint.String() + "\n")); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// serveHTTPClusterHealth responds with the health of the whole cluster as seen by
+// the local node, rather than the health of the node itself.
+func (s *HTTPServerHandler) serveHTTPClusterHealth(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.cluster_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing cluster health request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	var response clusterHealthResponse
+
+	ctx, cancel := s.dbHandler.newCheckContext()
+	defer cancel()
+
+	healthy, clusterInfo, err := s.dbHandler.GetClusterHealth(ctx)
+
+	switch {
+	case err != nil:
+		logrus.Errorf("Error reading cluster info: %v", err)
+		response.Message = "Could not determine the status of the MySQL cluster."
+	case healthy:
+		response.Message = fmt.Sprintf("MySQL cluster is healthy with %d nodes.", clusterInfo.Size)
+	case clusterInfo.Status != clusterPrimary:
+		response.Message = "MySQL cluster has no primary component."
+	default:
+		response.Message = fmt.Sprintf("MySQL cluster has %d of %d required nodes.",
+			clusterInfo.Size, s.dbHandler.clusterMinSize)
+	}
+
+	response.Healthy = healthy
+	response.Cluster = clusterInfo
+
+	var body []byte
+
+	if s.config.GetString("http.response_format") == "json" {
+		if body, err = s.marshalJSON(response); err != nil {
+			logrus.Errorf("Error encoding JSON response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		body = []byte(response.Message)
+	}
+
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// serveHTTPStats responds with the resource usage of the checker process and its
+// database connection pool as a JSON object.
+func (s *HTTPServerHandler) serveHTTPStats(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != s.config.GetString("http.stats_path") {
+		http.NotFound(w, req)
+		return
+	}
+
+	logrus.Debugf("Processing stats request from %s", req.RemoteAddr)
+	s.setConnectionHeader(w)
+
+	stats := NewStats(s.dbHandler.db)
+
+	if latencies := s.dbHandler.Latencies(); latencies != nil {
+		quantiles := latencies.Quantiles()
+		stats.CheckLatency = &quantiles
+	}
+
+	body, err := s.marshalJSON(stats)
+	if err != nil {
+		logrus.Errorf("Error encoding JSON response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(body); err != nil {
+		logrus.Errorf("Error writing data to HTTP response: %v", err)
+	}
+}
+
+// marshalJSON encodes a response body, renaming its snake_case keys to camelCase if
+// http.json_key_style is "camel".
+func (s *HTTPServerHandler) marshalJSON(v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil || s.config.GetString("http.json_key_style") != "camel" {
+		return body, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(camelCaseKeys(value))
+}
+
+// camelCaseKeys recursively renames the keys of decoded JSON objects to camelCase.
+func camelCaseKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			renamed[snakeToCamel(key)] = camelCaseKeys(child)
+		}
+
+		return renamed
+	case []interface{}:
+		for i, child := range v {
+			v[i] = camelCaseKeys(child)
+		}
+	}
+
+	return value
+}
+
+// snakeToCamel converts a snake_case key such as "local_index" to "localIndex".
+func snakeToCamel(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// setConnectionHeader asks the client to close the connection after the response,
+// unless http.keep_alive allows persistent connections to be reused by balancers.
+func (s *HTTPServerHandler) setConnectionHeader(w http.ResponseWriter) {
+	if !s.config.GetBool("http.keep_alive") {
+		w.Header().Add("Connection", "close")
+	}
+}
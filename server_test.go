@@ -0,0 +1,1237 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+)
+
+func expectSyncedRW(mock sqlmock.Sqlmock) {
+	mock.ExpectPing()
+	mock.ExpectPrepare(wsrepLocalStateQuery)
+	mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+	mock.ExpectPrepare(readOnlyQuery)
+	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+}
+
+func benchmarkKeepAlive(b *testing.B, keepAlive bool) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption((true)))
+	if err != nil {
+		b.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	config := viper.New()
+	config.Set("http.path", "/")
+	config.Set("http.keep_alive", keepAlive)
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	var connections int64
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(httpHandler.serveHTTPHealthCheck))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&connections, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		expectSyncedRW(mock)
+
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			b.Fatalf("Health check request failed: %v", err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			b.Errorf("Expected status code 200 but received %d.", resp.StatusCode)
+		}
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(&connections))/float64(b.N), "handshakes/op")
+}
+
+func BenchmarkConnectionClose(b *testing.B) {
+	benchmarkKeepAlive(b, false)
+}
+
+func BenchmarkKeepAlive(b *testing.B) {
+	benchmarkKeepAlive(b, true)
+}
+
+func TestJSONKeyStyle(t *testing.T) {
+	response := healthResponse{
+		Status:  "available",
+		Ready:   true,
+		Message: "MySQL cluster node is ready.",
+		Cluster: &ClusterInfo{Size: 3, Status: "Primary", LocalIndex: 1, StateUUID: "uuid"},
+	}
+
+	tests := []struct {
+		keyStyle string
+		expected string
+	}{
+		{"snake", `{"status":"available","ready":true,"message":"MySQL cluster node is ready.",` +
+			`"cluster":{"size":3,"status":"Primary","local_index":1,"state_uuid":"uuid"}}`},
+		{"camel", `{"cluster":{"localIndex":1,"size":3,"stateUuid":"uuid","status":"Primary"},` +
+			`"message":"MySQL cluster node is ready.","ready":true,"status":"available"}`},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.Set("http.json_key_style", test.keyStyle)
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{})
+
+		body, err := httpHandler.marshalJSON(response)
+		if err != nil {
+			t.Errorf("Failed to encode JSON response: %v", err)
+		}
+
+		if string(body) != test.expected {
+			t.Errorf("Expected %s keys %s but received %s.", test.keyStyle, test.expected, body)
+		}
+	}
+}
+
+func TestStopServerBeforeStart(t *testing.T) {
+	config := viper.New()
+	config.Set("http.addr", "127.0.0.1")
+	config.Set("http.port", 0)
+	config.Set("http.path", "/")
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{})
+	httpHandler.StopServer()
+	httpHandler.StopServer()
+
+	done := make(chan struct{})
+
+	go func() {
+		httpHandler.StartServer()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HTTP server started although it was stopped before starting.")
+	}
+}
+
+func TestFormatFromExtension(t *testing.T) {
+	tests := []struct {
+		path    string
+		enabled bool
+		status  int
+		json    bool
+	}{
+		{"/health", true, http.StatusServiceUnavailable, false},
+		{"/health.json", true, http.StatusServiceUnavailable, true},
+		{"/health.txt", true, http.StatusServiceUnavailable, false},
+		{"/health.xml", true, http.StatusNotFound, false},
+		{"/health.json", false, http.StatusNotFound, false},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		config := viper.New()
+		config.Set("http.path", "/health")
+		config.Set("http.response_format", "text")
+		config.Set("http.format_from_extension", test.enabled)
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPHealthCheck(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if recorder.Code != test.status {
+			t.Errorf("Expected status %d for %s but received %d.", test.status, test.path, recorder.Code)
+		}
+
+		if json := recorder.Header().Get("Content-Type") == "application/json"; json != test.json {
+			t.Errorf("Expected JSON response %t for %s but received %t.", test.json, test.path, json)
+		}
+	}
+}
+
+func TestMetricsRequestCounter(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	// The database is down, which must not keep the metrics from being served.
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	config := viper.New()
+	config.Set("http.path", "/")
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		httpHandler.metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected status %d from the metrics endpoint but received %d.", http.StatusOK, recorder.Code)
+		}
+
+		return recorder.Body.String()
+	}
+
+	if body := scrape(); !strings.Contains(body, "healthcheck_requests_total 0") {
+		t.Errorf("Expected no health check requests before the first check but received:\n%s", body)
+	}
+
+	httpHandler.serveHTTPHealthCheck(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := scrape()
+
+	if !strings.Contains(body, "healthcheck_requests_total 1") {
+		t.Errorf("Expected 1 health check request after a check but received:\n%s", body)
+	}
+
+	if !strings.Contains(body, `healthcheck_status{state="unavailable"} 1`) {
+		t.Errorf("Expected the unavailable state after a check but received:\n%s", body)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, port, _ := net.SplitHostPort(addr)
+
+	config := viper.New()
+	config.Set("http.addr", "127.0.0.1")
+	config.Set("http.port", port)
+	config.Set("http.path", "/")
+	config.Set("http.enable_h2c", true)
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(mock)
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	go httpHandler.StartServer()
+	defer httpHandler.StopServer()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+
+	var resp *http.Response
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if resp, err = client.Get("http://" + addr + "/"); err == nil || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("HTTP/2 health check request failed: %v", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected an HTTP/2 response but received %s.", resp.Proto)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d but received %d.", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestMultipleListenAddresses(t *testing.T) {
+	var addrs []string
+
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to find a free port: %v", err)
+		}
+
+		addrs = append(addrs, listener.Addr().String())
+		listener.Close()
+	}
+
+	config := viper.New()
+	config.Set("http.addr", addrs)
+	config.Set("http.port", 0)
+	config.Set("http.path", "/")
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(mock)
+	expectSyncedRW(mock)
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	done := make(chan struct{})
+
+	go func() {
+		httpHandler.StartServer()
+		close(done)
+	}()
+
+	for _, addr := range addrs {
+		var resp *http.Response
+
+		for deadline := time.Now().Add(5 * time.Second); ; {
+			if resp, err = http.Get("http://" + addr + "/"); err == nil || time.Now().After(deadline) {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err != nil {
+			t.Fatalf("Health check request to %s failed: %v", addr, err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status %d from %s but received %d.", http.StatusOK, addr, resp.StatusCode)
+		}
+	}
+
+	httpHandler.StopServer()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HTTP servers did not all stop.")
+	}
+}
+
+func TestIncludeLastError(t *testing.T) {
+	tests := []struct {
+		include       bool
+		basicAuth     bool
+		authorization string
+		expected      bool
+	}{
+		{true, false, "Bearer secret", true},
+		{true, false, "Bearer wrong", false},
+		{true, false, "", false},
+		{false, false, "Bearer secret", false},
+		{true, true, "Basic cHJvYmU6c2VjcmV0", true},
+		{false, true, "Basic cHJvYmU6c2VjcmV0", false},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing().WillReturnError(&mysql.MySQLError{Number: 1045, Message: "Access denied for user 'healthcheck'"})
+
+		config := viper.New()
+		config.Set("http.path", "/")
+		config.Set("http.response_format", "json")
+		config.Set("http.include_last_error", test.include)
+		config.Set("http.admin_token", "secret")
+
+		if test.basicAuth {
+			config.Set("http.auth.username", "probe")
+			config.Set("http.auth.password", "secret")
+		}
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPHealthCheck(recorder, req)
+
+		if included := strings.Contains(recorder.Body.String(), `"last_error":{"number":1045`); included != test.expected {
+			t.Errorf("Expected last error included %t with %q but received %s.", test.expected, test.authorization,
+				recorder.Body.String())
+		}
+	}
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		expect   func(mock sqlmock.Sqlmock)
+		path     string
+		status   int
+		response string
+	}{
+		{"synced liveness", func(mock sqlmock.Sqlmock) { mock.ExpectPing() }, "/livez", http.StatusOK,
+			livenessMessage},
+		{"synced readiness", expectSyncedRW, "/readyz", http.StatusOK, "MySQL cluster node is ready."},
+		{"read-only liveness", func(mock sqlmock.Sqlmock) { mock.ExpectPing() }, "/livez", http.StatusOK,
+			livenessMessage},
+		{"read-only readiness", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing()
+			mock.ExpectPrepare(wsrepLocalStateQuery)
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "ON"))
+		}, "/readyz", http.StatusServiceUnavailable, "MySQL cluster node is read-only."},
+		{"offline liveness", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}, "/livez", http.StatusServiceUnavailable, "Could not connect to the MySQL cluster node."},
+		{"offline readiness", func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}, "/readyz", http.StatusServiceUnavailable, "Could not connect to the MySQL cluster node."},
+		{"unknown path", func(sqlmock.Sqlmock) {}, "/livez/x", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		test.expect(mock)
+
+		config := viper.New()
+		config.Set("http.path", "/")
+		config.Set("http.liveness_path", "/livez")
+		config.Set("http.readiness_path", "/readyz")
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+		handler := httpHandler.serveHTTPReadiness
+		if strings.HasPrefix(test.path, "/livez") {
+			handler = httpHandler.serveHTTPLiveness
+		}
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if recorder.Code != test.status {
+			t.Errorf("Expected status %d for %s but received %d.", test.status, test.name, recorder.Code)
+		}
+
+		if test.response != "" && recorder.Body.String() != test.response {
+			t.Errorf("Expected %q for %s but received %q.", test.response, test.name, recorder.Body.String())
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet expectations for %s: %v", test.name, err)
+		}
+	}
+}
+
+func TestAcceptJSON(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "text/plain; charset=utf-8"},
+		{"*/*", "text/plain; charset=utf-8"},
+		{"text/plain", "text/plain; charset=utf-8"},
+		{"application/json", "application/json"},
+		{"text/html, application/json;q=0.9", "application/json"},
+		{"application/json;q=0", "text/plain; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		expectSyncedRW(mock)
+
+		config := viper.New()
+		config.Set("http.path", "/")
+		config.Set("http.response_format", "text")
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPHealthCheck(recorder, req)
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("Expected Content-Type %q for Accept %q but received %q.", test.contentType, test.accept, contentType)
+		}
+
+		if test.contentType != "application/json" {
+			if recorder.Body.String() != "MySQL cluster node is ready." {
+				t.Errorf("Expected a plain text response for Accept %q but received %q.", test.accept, recorder.Body.String())
+			}
+
+			continue
+		}
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode JSON response: %v", err)
+		}
+
+		if response["status"] != "available" || response["ready"] != true ||
+			response["message"] != "MySQL cluster node is ready." {
+			t.Errorf("Unexpected JSON response for Accept %q: %s", test.accept, recorder.Body.String())
+		}
+
+		checkedAt, _ := response["checked_at"].(string)
+		if _, err := time.Parse(time.RFC3339, checkedAt); err != nil {
+			t.Errorf("Expected checked_at in RFC 3339 format but received %q.", checkedAt)
+		}
+	}
+}
+
+func TestPortEndpoints(t *testing.T) {
+	mainDB, _, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	syncedDB, syncedMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	offlineDB, offlineMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(syncedMock)
+	offlineMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	config := viper.New()
+	config.Set("http.path", "/health")
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: mainDB})
+	httpHandler.AddPort(3307, &DBHandler{db: syncedDB})
+	httpHandler.AddPort(3308, &DBHandler{db: offlineDB})
+
+	router := httpHandler.newRouter()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/health/3307", http.StatusOK},
+		{"/health/3308", http.StatusServiceUnavailable},
+		{"/health/3309", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if recorder.Code != test.status {
+			t.Errorf("Expected status %d for %s but received %d.", test.status, test.path, recorder.Code)
+		}
+	}
+
+	for _, mock := range []sqlmock.Sqlmock{syncedMock, offlineMock} {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet expectations: %v", err)
+		}
+	}
+
+	if path := portHealthCheckPath("/", 3307); path != "/3307" {
+		t.Errorf("Expected /3307 below the root path but received %s.", path)
+	}
+}
+
+func TestWsrepStatePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		queryErr error
+		status   int
+		body     string
+	}{
+		{"synced", nil, http.StatusOK, "4"},
+		{"query failure", errors.New("connection refused"), http.StatusServiceUnavailable, "-1"},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPrepare(wsrepLocalStateQuery)
+
+		if test.queryErr != nil {
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnError(test.queryErr)
+		} else {
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+		}
+
+		config := viper.New()
+		config.Set("http.path", "/health")
+		config.Set("http.wsrep_state_path", "/wsrep_state")
+
+		recorder := httptest.NewRecorder()
+		router := NewHTTPServerHandler(config, &DBHandler{db: db}).newRouter()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/wsrep_state", nil))
+
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Errorf("Expected %d %q with %s but received %d %q.", test.status, test.body, test.name, recorder.Code,
+				recorder.Body.String())
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations with %s: %s", test.name, err)
+		}
+	}
+
+	config := viper.New()
+	config.Set("http.path", "/health")
+
+	recorder := httptest.NewRecorder()
+	router := NewHTTPServerHandler(config, &DBHandler{}).newRouter()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/wsrep_state", nil))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected the wsrep state endpoint not to be registered but received %d.", recorder.Code)
+	}
+}
+
+func TestStrictHeader(t *testing.T) {
+	tests := []struct {
+		allow         bool
+		authorization string
+		strict        string
+		expected      int
+	}{
+		{true, "Bearer secret", "true", http.StatusServiceUnavailable},
+		{true, "Bearer secret", "false", http.StatusOK},
+		{true, "Bearer wrong", "true", http.StatusOK},
+		{true, "", "true", http.StatusOK},
+		{false, "Bearer secret", "true", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing()
+		mock.ExpectPrepare(wsrepLocalStateQuery)
+		mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+
+		if test.expected == http.StatusServiceUnavailable {
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "ON"))
+		}
+
+		config := viper.New()
+		config.Set("http.path", "/")
+		config.Set("http.allow_header_overrides", test.allow)
+		config.Set("http.admin_token", "secret")
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db, availableWhenReadOnly: true})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(strictHeader, test.strict)
+
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPHealthCheck(recorder, req)
+
+		if recorder.Code != test.expected {
+			t.Errorf("Expected status %d for %s %s with %q and overrides allowed: %t, but received %d.",
+				test.expected, strictHeader, test.strict, test.authorization, test.allow, recorder.Code)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestConsulResponseMode(t *testing.T) {
+	tests := []struct {
+		responseMode string
+		result       CheckResult
+		expected     int
+	}{
+		{"default", CheckResult{Status: Available}, http.StatusOK},
+		{"default", CheckResult{Status: ReadOnly}, http.StatusServiceUnavailable},
+		{"consul", CheckResult{Status: Available}, http.StatusOK},
+		{"consul", CheckResult{Status: ReadOnly}, http.StatusTooManyRequests},
+		{"consul", CheckResult{Status: ReadOnly, Reason: ReasonDiskFull}, http.StatusTooManyRequests},
+		{"consul", CheckResult{Status: NotReady}, http.StatusServiceUnavailable},
+		{"consul", CheckResult{Status: Unavailable}, http.StatusServiceUnavailable},
+		{"consul", CheckResult{Status: Lagging}, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.Set("http.response_mode", test.responseMode)
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{})
+
+		if code := httpHandler.statusCode(test.result); code != test.expected {
+			t.Errorf("Expected status code %d for %+v in %s mode but received %d.", test.expected, test.result,
+				test.responseMode, code)
+		}
+	}
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing()
+	mock.ExpectPrepare(wsrepLocalStateQuery)
+	mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+	mock.ExpectPrepare(readOnlyQuery)
+	mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "ON"))
+
+	config := viper.New()
+	config.Set("http.path", "/")
+	config.Set("http.response_mode", "consul")
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	recorder := httptest.NewRecorder()
+	httpHandler.serveHTTPHealthCheck(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 for a read-only node in consul mode but received %d.", recorder.Code)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		credential []string
+		remoteAddr string
+		expected   int
+	}{
+		{"correct credentials", "probe", "secret", []string{"probe", "secret"}, "", http.StatusOK},
+		{"wrong password", "probe", "secret", []string{"probe", "wrong"}, "", http.StatusUnauthorized},
+		{"wrong username", "probe", "secret", []string{"other", "secret"}, "", http.StatusUnauthorized},
+		{"no credentials", "probe", "secret", nil, "", http.StatusUnauthorized},
+		{"no credentials from IPv4 loopback", "probe", "secret", nil, "127.0.0.1:40000", http.StatusOK},
+		{"no credentials from IPv6 loopback", "probe", "secret", nil, "[::1]:40000", http.StatusOK},
+		{"auth not configured", "", "", nil, "", http.StatusOK},
+		{"auth partly configured", "probe", "", nil, "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Errorf("Failed to open sqlmock database: %v", err)
+		}
+
+		if test.expected == http.StatusOK {
+			mock.ExpectPing()
+			mock.ExpectPrepare(wsrepLocalStateQuery)
+			mock.ExpectQuery(wsrepLocalStateQuery).WillReturnRows(getMockRow("wsrep_local_state", Synced))
+			mock.ExpectPrepare(readOnlyQuery)
+			mock.ExpectQuery(readOnlyQuery).WillReturnRows(getMockRow("read_only", "OFF"))
+		}
+
+		config := viper.New()
+		config.Set("http.path", "/")
+
+		if test.username != "" {
+			config.Set("http.auth.username", test.username)
+		}
+
+		if test.password != "" {
+			config.Set("http.auth.password", test.password)
+		}
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.credential != nil {
+			req.SetBasicAuth(test.credential[0], test.credential[1])
+		}
+
+		if test.remoteAddr != "" {
+			req.RemoteAddr = test.remoteAddr
+		}
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPHealthCheck(recorder, req)
+
+		if recorder.Code != test.expected {
+			t.Errorf("Expected status code %d with %s but received %d.", test.expected, test.name, recorder.Code)
+		}
+
+		if authenticate := recorder.Header().Get("WWW-Authenticate"); (authenticate != "") != (test.expected == http.StatusUnauthorized) {
+			t.Errorf("Unexpected WWW-Authenticate header %q with %s.", authenticate, test.name)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations with %s: %s", test.name, err)
+		}
+	}
+}
+
+func TestStandbyStatusCode(t *testing.T) {
+	tests := []struct {
+		standbyStatusCode int
+		result            CheckResult
+		expected          int
+	}{
+		{0, CheckResult{Status: Standby}, http.StatusOK},
+		{http.StatusTooManyRequests, CheckResult{Status: Standby}, http.StatusTooManyRequests},
+		{http.StatusTooManyRequests, CheckResult{Status: Available}, http.StatusOK},
+		{http.StatusTooManyRequests, CheckResult{Status: NotReady}, http.StatusServiceUnavailable},
+		{42, CheckResult{Status: Standby}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		if test.standbyStatusCode != 0 {
+			config.Set("http.standby_status_code", test.standbyStatusCode)
+		}
+
+		httpHandler := NewHTTPServerHandler(config, &DBHandler{})
+
+		if code := httpHandler.statusCode(test.result); code != test.expected {
+			t.Errorf("Expected status code %d for %+v with http.standby_status_code %d but received %d.", test.expected,
+				test.result, test.standbyStatusCode, code)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "healthcheck.sock")
+
+	// A stale socket file is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket file: %v", err)
+	}
+
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	config := viper.New()
+	config.Set("http.unix_socket", path)
+	config.Set("http.socket_mode", "0660")
+	config.Set("http.path", "/")
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(mock)
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	done := make(chan struct{})
+
+	go func() {
+		httpHandler.StartServer()
+		close(done)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+
+	var resp *http.Response
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if resp, err = client.Get("http://healthcheck/"); err == nil || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("Health check request over the Unix socket failed: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d but received %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+
+	if info, err := os.Stat(path); err != nil {
+		t.Errorf("Failed to stat socket file: %v", err)
+	} else if info.Mode().Perm() != 0o660 {
+		t.Errorf("Expected socket file mode 0660 but received %v.", info.Mode().Perm())
+	}
+
+	httpHandler.StopServer()
+	<-done
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the socket file to be removed but received %v.", err)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Errorf("Expected a missing socket file to be ignored but received %v.", err)
+	}
+
+	path := filepath.Join(dir, "healthcheck.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if err := removeStaleSocket(path); err == nil {
+		t.Error("Expected a regular file to be refused but it was accepted.")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the regular file to be kept but received %v.", err)
+	}
+}
+
+func TestDetailAuth(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		basicAuth     bool
+		authorization string
+		expected      int
+	}{
+		{"no auth configured", "", false, "", http.StatusUnauthorized},
+		{"correct token", "secret", false, "Bearer secret", http.StatusOK},
+		{"wrong token", "secret", false, "Bearer wrong", http.StatusUnauthorized},
+		{"basic auth", "", true, "Basic cHJvYmU6c2VjcmV0", http.StatusOK},
+		{"token with basic auth", "secret", true, "Bearer secret", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.Set("http.path", "/")
+		config.Set("http.detail_path", "/detail")
+		config.Set("http.admin_token", test.adminToken)
+
+		if test.basicAuth {
+			config.Set("http.auth.username", "probe")
+			config.Set("http.auth.password", "secret")
+		}
+
+		// A cached detailed status keeps the database out of the test.
+		dbHandler := &DBHandler{detail: &StatusDetail{Status: Available.String()}, detailAt: time.Now()}
+		httpHandler := NewHTTPServerHandler(config, dbHandler)
+
+		req := httptest.NewRequest(http.MethodGet, "/detail", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPDetail(recorder, req)
+
+		if recorder.Code != test.expected {
+			t.Errorf("Expected status code %d with %s but received %d.", test.expected, test.name, recorder.Code)
+		}
+
+		if test.expected == http.StatusOK && !strings.Contains(recorder.Body.String(), `"status":"available"`) {
+			t.Errorf("Expected the detailed status with %s but received %s.", test.name, recorder.Body.String())
+		}
+	}
+}
+
+func TestMaintenanceStatusCode(t *testing.T) {
+	maintenanceFile := filepath.Join(t.TempDir(), "maintenance")
+	if err := os.WriteFile(maintenanceFile, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create maintenance file: %v", err)
+	}
+
+	config := viper.New()
+	config.Set("http.path", "/")
+
+	// Within the startup grace period, maintenance must still not be reported as starting.
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{maintenanceFile: maintenanceFile,
+		startupGraceUntil: time.Now().Add(time.Minute)})
+
+	recorder := httptest.NewRecorder()
+	httpHandler.serveHTTPHealthCheck(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Body.String() != reasonMessages[ReasonMaintenance] {
+		t.Errorf("Expected %d %q but received %d %q.", http.StatusServiceUnavailable, reasonMessages[ReasonMaintenance],
+			recorder.Code, recorder.Body.String())
+	}
+}
+
+// writeServerCert writes a self-signed certificate for 127.0.0.1 and its key, and
+// returns their paths along with a pool trusting the certificate.
+func writeServerCert(t *testing.T) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "healthcheck"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server_cert.pem")
+	keyFile := filepath.Join(dir, "server_key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return certFile, keyFile, pool
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	certFile, keyFile, _ := writeServerCert(t)
+	otherCert, _, _ := writeServerCert(t)
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		ok       bool
+	}{
+		{"valid pair", certFile, keyFile, true},
+		{"missing key", certFile, "", false},
+		{"missing file", certFile, filepath.Join(t.TempDir(), "missing.pem"), false},
+		{"mismatched pair", otherCert, keyFile, false},
+	}
+
+	for _, test := range tests {
+		if _, err := newServerTLSConfig(test.certFile, test.keyFile); (err == nil) != test.ok {
+			t.Errorf("Expected %s to load: %t, but received error: %v", test.name, test.ok, err)
+		}
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	certFile, keyFile, pool := writeServerCert(t)
+
+	config := viper.New()
+	config.Set("http.addr", addr)
+	config.Set("http.path", "/")
+	config.Set("http.tls.cert", certFile)
+	config.Set("http.tls.key", keyFile)
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	expectSyncedRW(mock)
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db})
+
+	done := make(chan struct{})
+
+	go func() {
+		httpHandler.StartServer()
+		close(done)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	var resp *http.Response
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if resp, err = client.Get("https://" + addr + "/"); err == nil || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("Health check request over TLS failed: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d but received %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+
+	if resp.TLS == nil {
+		t.Error("Expected the response to be served over TLS.")
+	}
+
+	httpHandler.StopServer()
+	<-done
+}
+
+func TestJSONCustomQueryDuration(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %v", err)
+	}
+
+	mock.ExpectPing()
+	mock.ExpectPrepare("SELECT status FROM health;")
+	mock.ExpectQuery("SELECT status FROM health;").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("OK"))
+
+	config := viper.New()
+	config.Set("http.path", "/")
+	config.Set("http.response_format", "json")
+
+	httpHandler := NewHTTPServerHandler(config, &DBHandler{db: db, customQuery: "SELECT status FROM health;",
+		customResult: "OK"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler.serveHTTPHealthCheck(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var response healthResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode JSON response %s: %v", recorder.Body.String(), err)
+	}
+
+	if response.CustomQueryDuration == nil {
+		t.Errorf("Expected the custom query duration in the response but received %s.", recorder.Body.String())
+	}
+}
+
+func TestStartupGracePeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  time.Duration
+		pingErr  error
+		status   int
+		response string
+	}{
+		{"within grace", 0, errors.New("connection refused"), http.StatusServiceUnavailable,
+			reasonMessages[ReasonStarting]},
+		{"after grace", time.Hour, errors.New("connection refused"), http.StatusServiceUnavailable,
+			"Could not connect to the MySQL cluster node."},
+		{"auth within grace", 0, &mysql.MySQLError{Number: errAccessDenied, Message: "Access denied"},
+			http.StatusServiceUnavailable, reasonMessages[ReasonAuth]},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("Failed to open sqlmock database: %v", err)
+		}
+
+		mock.ExpectPing().WillReturnError(test.pingErr)
+
+		config := viper.New()
+		config.Set("http.path", "/")
+
+		dbHandler := &DBHandler{db: db, startupGraceUntil: time.Now().Add(time.Minute - test.started)}
+		httpHandler := NewHTTPServerHandler(config, dbHandler)
+
+		recorder := httptest.NewRecorder()
+		httpHandler.serveHTTPHealthCheck(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if recorder.Code != test.status || recorder.Body.String() != test.response {
+			t.Errorf("Expected %d %q %s but received %d %q.", test.status, test.response, test.name, recorder.Code,
+				recorder.Body.String())
+		}
+	}
+}
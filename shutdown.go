@@ -0,0 +1,62 @@
+/*
+Shutdown.go summarizes the lifetime of the daemon when it shuts down.
+*/
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ResultTally counts the health check results served over the lifetime of the
+// daemon, which outlives the HTTP server replaced on every reload.
+type ResultTally struct {
+	startedAt time.Time
+
+	mu     sync.Mutex
+	counts map[ServerStatus]int
+}
+
+// NewResultTally creates a ResultTally counting the uptime from now.
+func NewResultTally() *ResultTally {
+	return &ResultTally{startedAt: time.Now(), counts: make(map[ServerStatus]int)}
+}
+
+// Observe counts result.
+func (t *ResultTally) Observe(result CheckResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counts[result.Status]++
+}
+
+// SummaryFields returns the structured fields of the shutdown summary: the total
+// number of checks, their count per result, the uptime and the shutdown reason.
+// Results are flattened into one field each, so the summary reads the same with
+// the text and JSON log formatters.
+func (t *ResultTally) SummaryFields(reason string) logrus.Fields {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := 0
+	fields := logrus.Fields{
+		"uptime": time.Since(t.startedAt).Round(time.Second).String(),
+		"reason": reason,
+	}
+
+	for status, count := range t.counts {
+		fields["results_"+status.String()] = count
+		total += count
+	}
+
+	fields["checks"] = total
+
+	return fields
+}
+
+// LogSummary logs the shutdown summary as a single record.
+func (t *ResultTally) LogSummary(reason string) {
+	logrus.WithFields(t.SummaryFields(reason)).Info("Shutting down.")
+}
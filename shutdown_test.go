@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestResultTallySummaryFields(t *testing.T) {
+	tally := NewResultTally()
+
+	tally.Observe(CheckResult{Status: Available})
+	tally.Observe(CheckResult{Status: Available})
+	tally.Observe(CheckResult{Status: NotReady, Reason: ReasonRecovering})
+
+	fields := tally.SummaryFields("received terminated signal")
+
+	expected := map[string]interface{}{
+		"checks":            3,
+		"results_available": 2,
+		"results_notready":  1,
+		"reason":            "received terminated signal",
+	}
+
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Expected %s to be %v but received %v.", key, value, fields[key])
+		}
+	}
+
+	if _, ok := fields["results_readonly"]; ok {
+		t.Error("Expected no field for results which were never served.")
+	}
+
+	if _, ok := fields["uptime"].(string); !ok {
+		t.Errorf("Expected the uptime as a string but received %v.", fields["uptime"])
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Stats.go reports resource usage of the checker process and its database connection pool.
+*/
+package main
+
+import (
+	"database/sql"
+	"runtime"
+	"time"
+)
+
+// Stats is a snapshot of the resource usage of the checker process, used to size
+// its resource limits and detect goroutine leaks.
+type Stats struct {
+	Goroutines int         `json:"goroutines"`
+	Memory     MemoryStats `json:"memory"`
+	GC         GCStats     `json:"gc"`
+	Pool       PoolStats   `json:"pool"`
+
+	CheckLatency *LatencyQuantiles `json:"check_latency,omitempty"`
+}
+
+// MemoryStats reports the memory usage of the process in bytes.
+type MemoryStats struct {
+	HeapAlloc   uint64 `json:"heap_alloc_bytes"`
+	HeapInuse   uint64 `json:"heap_inuse_bytes"`
+	StackInuse  uint64 `json:"stack_inuse_bytes"`
+	Sys         uint64 `json:"sys_bytes"`
+	TotalAlloc  uint64 `json:"total_alloc_bytes"`
+	HeapObjects uint64 `json:"heap_objects"`
+}
+
+// GCStats reports the garbage collector activity of the process.
+type GCStats struct {
+	NumGC      uint32  `json:"num_gc"`
+	PauseTotal float64 `json:"pause_total_seconds"`
+	LastPause  float64 `json:"last_pause_seconds"`
+}
+
+// PoolStats reports the state of the database connection pool.
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDuration       float64 `json:"wait_duration_seconds"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+// NewStats collects a snapshot of the process and connection pool stats.  Reading
+// the memory stats briefly stops the world, so this is only meant for occasional
+// debugging requests.
+func NewStats(db *sql.DB) Stats {
+	var memStats runtime.MemStats
+
+	runtime.ReadMemStats(&memStats)
+
+	var lastPause time.Duration
+	if memStats.NumGC > 0 {
+		lastPause = time.Duration(memStats.PauseNs[(memStats.NumGC+255)%256])
+	}
+
+	poolStats := db.Stats()
+
+	return Stats{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			HeapAlloc:   memStats.HeapAlloc,
+			HeapInuse:   memStats.HeapInuse,
+			StackInuse:  memStats.StackInuse,
+			Sys:         memStats.Sys,
+			TotalAlloc:  memStats.TotalAlloc,
+			HeapObjects: memStats.HeapObjects,
+		},
+		GC: GCStats{
+			NumGC:      memStats.NumGC,
+			PauseTotal: time.Duration(memStats.PauseTotalNs).Seconds(),
+			LastPause:  lastPause.Seconds(),
+		},
+		Pool: PoolStats{
+			MaxOpenConnections: poolStats.MaxOpenConnections,
+			OpenConnections:    poolStats.OpenConnections,
+			InUse:              poolStats.InUse,
+			Idle:               poolStats.Idle,
+			WaitCount:          poolStats.WaitCount,
+			WaitDuration:       poolStats.WaitDuration.Seconds(),
+			MaxIdleClosed:      poolStats.MaxIdleClosed,
+			MaxLifetimeClosed:  poolStats.MaxLifetimeClosed,
+		},
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNewStats(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Errorf("Failed to open sqlmock database: %v", err)
+	}
+
+	db.SetMaxOpenConns(databaseMaxOpenConns)
+	runtime.GC()
+
+	stats := NewStats(db)
+
+	if stats.Goroutines < 1 {
+		t.Errorf("Expected at least one goroutine but received %d.", stats.Goroutines)
+	}
+
+	if stats.Memory.Sys == 0 || stats.Memory.HeapAlloc == 0 {
+		t.Errorf("Expected memory usage to be reported but received %+v.", stats.Memory)
+	}
+
+	if stats.GC.NumGC == 0 {
+		t.Errorf("Expected at least one garbage collection to be reported but received %+v.", stats.GC)
+	}
+
+	if stats.Pool.MaxOpenConnections != databaseMaxOpenConns {
+		t.Errorf("Expected %d max open connections but received %d.", databaseMaxOpenConns,
+			stats.Pool.MaxOpenConnections)
+	}
+}
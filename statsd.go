@@ -0,0 +1,76 @@
+/*
+Statsd.go pushes health check results to a StatsD endpoint, for push-based monitoring stacks.
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// StatsDClient sends metrics about each health check to a StatsD endpoint over UDP.
+// Sending is fire and forget, so an unreachable endpoint never slows checks down.
+type StatsDClient struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+// NewStatsDClient creates a StatsDClient sending to statsd.addr.  Metric names are
+// prefixed with statsd.prefix, and statsd.tags are appended in the DogStatsD
+// format if set.
+func NewStatsDClient(config *viper.Viper) (*StatsDClient, error) {
+	conn, err := net.Dial("udp", config.GetString("statsd.addr"))
+	if err != nil {
+		return nil, err
+	}
+
+	instance := new(StatsDClient)
+	instance.conn = conn
+	instance.prefix = config.GetString("statsd.prefix")
+
+	if tags := config.GetStringSlice("statsd.tags"); len(tags) > 0 {
+		instance.tags = "|#" + strings.Join(tags, ",")
+	}
+
+	return instance, nil
+}
+
+// ObserveCheck sends the result and duration of a health check, along with the
+// wsrep_local_state seen by the check if known, in a single packet.  The duration
+// of a cold-start check is sent as coldstart_check_latency instead.
+func (c *StatsDClient) ObserveCheck(result CheckResult, duration time.Duration, coldStart bool, wsrepState WsrepStatus,
+	wsrepKnown bool) error {
+	available := 0
+	if result.Status == Available {
+		available = 1
+	}
+
+	latencyName := "check_latency"
+	if coldStart {
+		latencyName = "coldstart_check_latency"
+	}
+
+	lines := []string{
+		fmt.Sprintf("%sresults.%s:1|c%s", c.prefix, result.Status, c.tags),
+		fmt.Sprintf("%savailable:%d|g%s", c.prefix, available, c.tags),
+		fmt.Sprintf("%s%s:%.3f|ms%s", c.prefix, latencyName, float64(duration)/float64(time.Millisecond), c.tags),
+	}
+
+	if wsrepKnown {
+		lines = append(lines, fmt.Sprintf("%swsrep_local_state:%d|g%s", c.prefix, wsrepState, c.tags))
+	}
+
+	_, err := c.conn.Write([]byte(strings.Join(lines, "\n")))
+
+	return err
+}
+
+// Close closes the UDP socket.
+func (c *StatsDClient) Close() error {
+	return c.conn.Close()
+}
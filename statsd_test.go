@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestStatsDClientObserveCheck(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for StatsD packets: %v", err)
+	}
+	defer listener.Close()
+
+	config := viper.New()
+	config.Set("statsd.addr", listener.LocalAddr().String())
+	config.Set("statsd.prefix", "db.")
+	config.Set("statsd.tags", []string{"env:test"})
+
+	client, err := NewStatsDClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create StatsD client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.ObserveCheck(CheckResult{Status: Available}, 1500*time.Microsecond, false, Synced, true); err != nil {
+		t.Errorf("Failed to send StatsD metrics: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+
+	if err := listener.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Failed to set read deadline: %v", err)
+	}
+
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive StatsD packet: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"db.results.available:1|c|#env:test",
+		"db.available:1|g|#env:test",
+		"db.check_latency:1.500|ms|#env:test",
+		"db.wsrep_local_state:4|g|#env:test",
+	}, "\n")
+
+	if packet := string(buf[:n]); packet != expected {
+		t.Errorf("Expected StatsD packet %q but received %q.", expected, packet)
+	}
+}